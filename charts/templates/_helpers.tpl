@@ -16,4 +16,58 @@ Selector labels
 */}}
 {{- define "scc.selectorLabels" -}}
 app: simple-custom-controller
-{{- end }}
\ No newline at end of file
+{{- end }}
+
+{{/*
+Rules on the objects handled in the watched namespaces
+*/}}
+{{- define "scc.workloadRules" -}}
+- apiGroups: [""]
+  resources:
+    - pods
+  verbs:
+    - get
+    - list
+    - watch
+- apiGroups: ["", "apps"]
+  resources:
+    - services
+    - deployments
+    - configmaps
+  verbs:
+    - get
+    - create
+    - update
+    - delete
+- apiGroups: [""]
+  resources:
+    - secrets
+  verbs:
+    - get
+    - create
+    - update
+    - delete
+- apiGroups: ["simplecustomcontroller.crd.com"]
+  resources:
+    - books
+  verbs:
+    - get
+    - list
+    - watch
+    - create
+    - update
+    - patch
+    - delete
+- apiGroups: ["simplecustomcontroller.crd.com"]
+  resources:
+    - books/status
+  verbs:
+    - update
+- apiGroups: [""]
+  resources:
+    - events
+  verbs:
+    - create
+    - patch
+    - update
+{{- end }}
@@ -3,21 +3,30 @@ package controller
 import (
 	"context"
 	"fmt"
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
 	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/certs"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoy"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoyadmin"
 	clientset "github.com/shiponcs/simple-custom-controller/pkg/generated/clientset/versioned"
 	samplescheme "github.com/shiponcs/simple-custom-controller/pkg/generated/clientset/versioned/scheme"
-	informers "github.com/shiponcs/simple-custom-controller/pkg/generated/informers/externalversions/simplecustomcontroller/v1"
 	listers "github.com/shiponcs/simple-custom-controller/pkg/generated/listers/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	"github.com/shiponcs/simple-custom-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	appsinformers "k8s.io/client-go/informers/apps/v1"
-	coreinformer "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -27,12 +36,22 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
-	"os"
+	"k8s.io/utils/clock"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const controllerAgentName = "simple-custom-controller"
 
+// cancelledSyncsTimeout is how long Run waits for the syncs it cancelled at
+// the end of the shutdown grace period before it returns anyway.
+const cancelledSyncsTimeout = 5 * time.Second
+
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a Book is synced
 	SuccessSynced = "Synced"
@@ -48,8 +67,58 @@ const (
 	MessageResourceSynced = "book synced successfully"
 	// FieldManager distinguishes this controller from other things writing to API objects
 	FieldManager = controllerAgentName
+
+	// ManagedByLabel is set to ManagedByValue on every object created for a
+	// Book. The Deployment and Service informers only watch the labeled
+	// objects.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel.
+	ManagedByValue = controllerAgentName
+	// BookLabel is set on every object created for a Book to the name of the
+	// Book.
+	BookLabel = "simplecustomcontroller.crd.com/book"
 )
 
+// Options holds the settings of the controller other than its clients and
+// informers.
+type Options struct {
+	// Sharder restricts the controller to its own slice of the Books. Every
+	// Book is handled when nil.
+	Sharder Sharder
+	// ResyncPeriod is the resync period of the informers.
+	ResyncPeriod time.Duration
+	// RateLimiter configures the retries of the workqueue.
+	RateLimiter configv1alpha1.RateLimiterConfiguration
+	// Envoy holds the defaults of the envoy proxies.
+	Envoy configv1alpha1.EnvoyConfiguration
+	// ReconcileTimeout is the deadline of a single Book sync.
+	ReconcileTimeout time.Duration
+	// DryRun sends every write of the sync loop with DryRun: All and logs
+	// the changes they would make. Status updates and Events are skipped.
+	DryRun bool
+	// ShutdownGracePeriod is how long Run waits for the in-flight syncs to
+	// finish once its context is cancelled.
+	ShutdownGracePeriod time.Duration
+	// MutualTLS configures the certificates of the Books using mutual TLS.
+	// CASecretNamespace must be set.
+	MutualTLS configv1alpha1.MutualTLSConfiguration
+	// Clock decides the validity of the certificates. The real clock is
+	// used when nil.
+	Clock clock.Clock
+}
+
+// Sharder decides which controller replica is responsible for a Book when
+// the Books are split between several replicas.
+type Sharder interface {
+	// ID identifies the shard served by this replica.
+	ID() string
+	// Owns reports whether the Book belongs to the shard of this replica.
+	Owns(objectRef cache.ObjectName) bool
+	// HasSynced reports whether the shard membership is known. Owns
+	// returns false for every Book until then.
+	HasSynced() bool
+}
+
 type Controller struct {
 	// kubeclientset is a standard kubernetes clientset
 	kubeclientset kubernetes.Interface
@@ -62,15 +131,68 @@ type Controller struct {
 	bookSynced        cache.InformerSynced
 	serviceLister     corelisters.ServiceLister
 	serviceSynced     cache.InformerSynced
+	podLister         corelisters.PodLister
+	podsSynced        cache.InformerSynced
+	// bookIndexers look the Books up by the objects they refer to.
+	bookIndexers bookIndexers
+	// jwksHashes are the hashes of the ConfigMaps and Secrets holding key
+	// sets, by jwksIndex key, as last read by pollJWKS. Only pollJWKS uses
+	// them.
+	jwksHashes map[string]string
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
 	// time, and makes it easy to ensure we are never processing the same item
-	// simultaneously in two different workers.
-	workqueue workqueue.TypedRateLimitingInterface[cache.ObjectName]
+	// simultaneously in two different workers. Changes made by users go ahead
+	// of the periodic resyncs.
+	workqueue *priorityqueue.Queue[cache.ObjectName]
+	// resyncPeriod is the resync period of the informers. The resync of the
+	// Books is spread over half of it.
+	resyncPeriod time.Duration
+	// maxRetries is the number of times a Book failing with transient errors
+	// is retried before it is marked Degraded.
+	maxRetries int
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
+	// eventBroadcaster delivers the recorded Events. It is shut down once
+	// the workers have stopped.
+	eventBroadcaster record.EventBroadcaster
+	// reconcileTimeout is the deadline of a single Book sync.
+	reconcileTimeout time.Duration
+	// dryRun collects the changes that would have been made. It is nil
+	// unless the controller runs in dry-run mode.
+	dryRun *dryRunReport
+	// shutdownGracePeriod is how long the in-flight syncs are given to
+	// finish on shutdown.
+	shutdownGracePeriod time.Duration
+	// sharder restricts the controller to its own slice of the Books. It is
+	// nil when a single replica handles every Book.
+	sharder Sharder
+	// bucketLimiter is the overall rate limit of the workqueue retries. It
+	// can be changed while the controller runs.
+	bucketLimiter *rate.Limiter
+	// envoyDefaults holds the current EnvoyConfiguration.
+	envoyDefaults atomic.Pointer[configv1alpha1.EnvoyConfiguration]
+	// mutualTLS holds the current MutualTLSConfiguration.
+	mutualTLS atomic.Pointer[configv1alpha1.MutualTLSConfiguration]
+	clock     clock.Clock
+	// idle tracks the activity of the Books with spec.idle.
+	idle idleTracker
+	// ca is the certificate authority, loaded on first use.
+	caMu sync.Mutex
+	ca   *certs.CA
+	// envoyAdmin queries the admin API of the envoy proxies, whose answers
+	// are kept in envoyHealth.
+	envoyAdmin  *envoyadmin.Client
+	envoyHealth envoyHealth
+	// lastProgress is the unix time in nanoseconds at which a worker last
+	// finished processing an item. It feeds the liveness watchdog.
+	lastProgress atomic.Int64
+	// running is set once Run is called, that is once this replica leads
+	// when leader election is enabled. A standby queues the Books its
+	// informers list but processes none of them.
+	running atomic.Bool
 }
 
 // NewController returns a new controller
@@ -78,9 +200,8 @@ func NewController(
 	ctx context.Context,
 	kubeclientset kubernetes.Interface,
 	Bookclientset clientset.Interface,
-	deploymentInformer appsinformers.DeploymentInformer,
-	serviceInformer coreinformer.ServiceInformer,
-	BookInformer informers.BookInformer) *Controller {
+	informerSets []InformerSet,
+	opts Options) *Controller {
 	logger := klog.FromContext(ctx)
 
 	// Create event broadcaster
@@ -93,31 +214,138 @@ func NewController(
 	eventBroadcaster.StartStructuredLogging(0)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	bucketLimiter := rate.NewLimiter(rate.Limit(opts.RateLimiter.QPS), int(opts.RateLimiter.Burst))
 	ratelimiter := workqueue.NewTypedMaxOfRateLimiter(
-		workqueue.NewTypedItemExponentialFailureRateLimiter[cache.ObjectName](5*time.Millisecond, 1000*time.Second),
-		&workqueue.TypedBucketRateLimiter[cache.ObjectName]{Limiter: rate.NewLimiter(rate.Limit(50), 300)},
+		workqueue.NewTypedItemExponentialFailureRateLimiter[cache.ObjectName](opts.RateLimiter.BaseDelay.Duration, opts.RateLimiter.MaxDelay.Duration),
+		&workqueue.TypedBucketRateLimiter[cache.ObjectName]{Limiter: bucketLimiter},
 	)
+	queue := priorityqueue.New(ratelimiter, priorityqueue.Config{
+		Name:            "books",
+		MetricsProvider: metrics.WorkqueueProvider{},
+	})
+
+	deploymentsLister := mergedDeploymentLister{}
+	bookLister := mergedBookLister{}
+	serviceLister := mergedServiceLister{}
+	podLister := mergedPodLister{}
+	var deploymentsSynced, bookSynced, serviceSynced, podsSynced []cache.InformerSynced
+	var indexers bookIndexers
+	for _, set := range informerSets {
+		utilruntime.Must(set.Books.Informer().AddIndexers(cache.Indexers{jwksIndex: jwksIndexFunc, mirrorIndex: mirrorIndexFunc}))
+		indexers = append(indexers, set.Books.Informer().GetIndexer())
+		deploymentsLister[set.Namespace] = set.Deployments.Lister()
+		deploymentsSynced = append(deploymentsSynced, set.Deployments.Informer().HasSynced)
+		bookLister[set.Namespace] = set.Books.Lister()
+		bookSynced = append(bookSynced, set.Books.Informer().HasSynced)
+		serviceLister[set.Namespace] = set.Services.Lister()
+		serviceSynced = append(serviceSynced, set.Services.Informer().HasSynced)
+		podLister[set.Namespace] = set.Pods.Lister()
+		podsSynced = append(podsSynced, set.Pods.Informer().HasSynced)
+	}
 
 	controller := &Controller{
-		kubeclientset:     kubeclientset,
-		sampleclientset:   Bookclientset,
-		deploymentsLister: deploymentInformer.Lister(),
-		deploymentsSynced: deploymentInformer.Informer().HasSynced,
-		bookLister:        BookInformer.Lister(),
-		bookSynced:        BookInformer.Informer().HasSynced,
-		serviceLister:     serviceInformer.Lister(),
-		serviceSynced:     serviceInformer.Informer().HasSynced,
-		workqueue:         workqueue.NewTypedRateLimitingQueue(ratelimiter),
-		recorder:          recorder,
+		kubeclientset:       kubeclientset,
+		sampleclientset:     Bookclientset,
+		deploymentsLister:   deploymentsLister,
+		deploymentsSynced:   allSynced(deploymentsSynced),
+		bookLister:          bookLister,
+		bookSynced:          allSynced(bookSynced),
+		serviceLister:       serviceLister,
+		serviceSynced:       allSynced(serviceSynced),
+		podLister:           podLister,
+		podsSynced:          allSynced(podsSynced),
+		bookIndexers:        indexers,
+		workqueue:           queue,
+		resyncPeriod:        opts.ResyncPeriod,
+		maxRetries:          int(opts.RateLimiter.MaxRetries),
+		recorder:            recorder,
+		eventBroadcaster:    eventBroadcaster,
+		reconcileTimeout:    opts.ReconcileTimeout,
+		shutdownGracePeriod: opts.ShutdownGracePeriod,
+		sharder:             opts.Sharder,
+		clock:               opts.Clock,
+		bucketLimiter:       bucketLimiter,
+		envoyAdmin:          envoyadmin.NewClient(envoyAdminTimeout),
+		envoyHealth: envoyHealth{
+			samples: map[types.UID]envoySample{},
+			reports: map[cache.ObjectName]envoyReport{},
+		},
+		idle: idleTracker{books: map[cache.ObjectName]*idleState{}},
+	}
+	if opts.DryRun {
+		controller.dryRun = newDryRunReport()
 	}
+	if controller.clock == nil {
+		controller.clock = clock.RealClock{}
+	}
+	controller.envoyDefaults.Store(&opts.Envoy)
+	controller.mutualTLS.Store(&opts.MutualTLS)
+	controller.lastProgress.Store(time.Now().UnixNano())
 
 	logger.Info("Setting up event handlers")
-	// Set up an event handler for when book resources change
-	BookInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.enqueueBook,
+	for _, set := range informerSets {
+		controller.addEventHandlers(set)
+	}
+
+	return controller
+}
+
+// addEventHandlers registers the controller with the informers of set.
+func (c *Controller) addEventHandlers(set InformerSet) {
+	metrics.RegisterInformerCache("books", set.Books.Informer().GetStore())
+	metrics.RegisterInformerCache("deployments", set.Deployments.Informer().GetStore())
+	metrics.RegisterInformerCache("services", set.Services.Informer().GetStore())
+	metrics.RegisterInformerCache("pods", set.Pods.Informer().GetStore())
+
+	// Set up an event handler for when book resources change. When sharding
+	// is enabled only the Books of our own shard get through.
+	set.Books.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: c.ownsObject,
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueueBook(obj, priorityqueue.High)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				newBook := new.(*bookv1.Book)
+				oldBook := old.(*bookv1.Book)
+				if newBook.ResourceVersion == oldBook.ResourceVersion {
+					// Periodic resync will send update events for all known
+					// Books. They wait behind the real changes.
+					c.enqueueResync(new)
+					return
+				}
+				if newBook.Annotations[bookv1.ReconcileAtAnnotation] != oldBook.Annotations[bookv1.ReconcileAtAnnotation] {
+					c.requestReconcile(new)
+					return
+				}
+				if newBook.Generation != oldBook.Generation ||
+					!maps.Equal(newBook.Labels, oldBook.Labels) ||
+					!maps.Equal(newBook.Annotations, oldBook.Annotations) {
+					c.enqueueBook(new, priorityqueue.High)
+					return
+				}
+				// Status updates, mostly written by the controller itself,
+				// do not hold up the changes made by users.
+				c.enqueueBook(new, priorityqueue.Low)
+			},
+			// The sync of a deleted Book finds it gone and drops its
+			// metrics and Envoy report.
+			DeleteFunc: func(obj interface{}) {
+				c.enqueueBook(obj, priorityqueue.Normal)
+			},
+		},
+	})
+	// Books mirroring to a Book follow its changes. The handler is not
+	// filtered by shard since the mirroring Books may be in any shard.
+	set.Books.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueMirroringBooks,
 		UpdateFunc: func(old, new interface{}) {
-			controller.enqueueBook(new)
+			if new.(*bookv1.Book).ResourceVersion == old.(*bookv1.Book).ResourceVersion {
+				return
+			}
+			c.enqueueMirroringBooks(new)
 		},
+		DeleteFunc: c.enqueueMirroringBooks,
 	})
 	// Set up an event handler for when Deployment resources change. This
 	// handler will lookup the owner of the given Deployment, and if it is
@@ -125,8 +353,10 @@ func NewController(
 	// processing. This way, we don't need to implement custom logic for
 	// handling Deployment resources. More info on this pattern:
 	// https://github.com/kubernetes/community/blob/8cafef897a22026d42f5e5bb3f104febe7e29830/contributors/devel/controllers.md
-	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleObject,
+	set.Deployments.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.handleObject(obj, priorityqueue.Normal)
+		},
 		UpdateFunc: func(old, new interface{}) {
 			newDepl := new.(*appsv1.Deployment)
 			oldDepl := old.(*appsv1.Deployment)
@@ -135,59 +365,186 @@ func NewController(
 				// Two different versions of the same Deployment will always have different RVs.
 				return
 			}
-			controller.handleObject(new)
+			c.handleObject(new, priorityqueue.Normal)
+		},
+		// A deleted child is restored ahead of the resyncs.
+		DeleteFunc: func(obj interface{}) {
+			c.handleObject(obj, priorityqueue.High)
 		},
-		DeleteFunc: controller.handleObject,
 	})
 	// setup event handler for service just like how we set for Deployment
-	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleObject,
+	set.Services.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.handleObject(obj, priorityqueue.Normal)
+		},
 		UpdateFunc: func(old, new interface{}) {
 			newService := new.(*corev1.Service)
 			oldService := old.(*corev1.Service)
 			if newService.ResourceVersion == oldService.ResourceVersion {
 				return
 			}
-			controller.handleObject(new)
+			c.handleObject(new, priorityqueue.Normal)
+		},
+		// A deleted child is restored ahead of the resyncs.
+		DeleteFunc: func(obj interface{}) {
+			c.handleObject(obj, priorityqueue.High)
 		},
-		DeleteFunc: controller.handleObject,
 	})
-
-	return controller
+	// The pods of a Book are mapped to it through their labels so that
+	// their problems show up in the status of the Book.
+	set.Pods.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.handlePod,
+		UpdateFunc: func(old, new interface{}) {
+			newPod := new.(*corev1.Pod)
+			oldPod := old.(*corev1.Pod)
+			if newPod.ResourceVersion == oldPod.ResourceVersion {
+				return
+			}
+			c.handlePod(new)
+		},
+		DeleteFunc: c.handlePod,
+	})
 }
 
 // Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
+// as syncing informer caches and starting workers. It will block until ctx
+// is cancelled, at which point it will shutdown the workqueue and wait for
+// workers to finish processing the queued items. The syncs still running
+// after the grace period are cancelled, and abandoned if they do not return
+// shortly after.
 func (c *Controller) Run(ctx context.Context, workers int) error {
 	defer utilruntime.HandleCrash()
-	defer c.workqueue.ShutDown()
+	defer c.eventBroadcaster.Shutdown()
 	logger := klog.FromContext(ctx)
 
 	// Start the informer factories to begin populating the informer caches
 	logger.Info("Starting book controller")
+	c.lastProgress.Store(time.Now().UnixNano())
+	c.running.Store(true)
 
 	// Wait for the caches to be synced before starting workers
 	logger.Info("Waiting for informer caches to sync")
 
-	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.bookSynced, c.serviceSynced); !ok {
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.deploymentsSynced, c.bookSynced, c.serviceSynced, c.podsSynced, c.shardSynced); !ok {
+		c.workqueue.ShutDown()
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
+	if c.sharder != nil {
+		// The Books listed before the shard membership was known were
+		// filtered out by the event handler.
+		c.Rebalance()
+	}
+
+	c.lastProgress.Store(time.Now().UnixNano())
+
+	// The syncs run with a context that outlives ctx, so that a shutdown
+	// lets them finish instead of failing their API calls halfway.
+	workerCtx, cancelWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWorkers()
 
 	logger.Info("Starting workers", "count", workers)
 	// Launch two workers to process book resources
+	var wg sync.WaitGroup
 	for i := 0; i < workers; i++ {
-		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runWorker(workerCtx)
+		}()
 	}
 
+	go c.runEnvoyScraper(ctx)
+	go c.runJWKSPoller(ctx)
+	go c.runIdleWaker(ctx)
+
 	logger.Info("Started workers")
 	<-ctx.Done()
-	logger.Info("Shutting down workers")
+	logger.Info("Shutting down workers", "gracePeriod", c.shutdownGracePeriod)
 
+	drained := make(chan struct{})
+	go func() {
+		c.workqueue.ShutDownWithDrain()
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		logger.Info("Workers stopped")
+	case <-time.After(c.shutdownGracePeriod):
+		logger.Info("Grace period expired, cancelling the in-flight syncs")
+		cancelWorkers()
+		// A sync that ignores its context would otherwise block the
+		// shutdown forever.
+		select {
+		case <-drained:
+			logger.Info("Workers stopped")
+		case <-time.After(cancelledSyncsTimeout):
+			logger.Info("Abandoning the syncs that ignored their cancellation", "objectRefs", c.workqueue.Processing())
+		}
+	}
+	if c.dryRun != nil {
+		c.dryRun.logSummary(logger)
+	}
+
+	return nil
+}
+
+// CachesSynced is a readiness check. It passes once the informer caches have
+// synced.
+func (c *Controller) CachesSynced(*http.Request) error {
+	if !c.deploymentsSynced() || !c.bookSynced() || !c.serviceSynced() || !c.podsSynced() {
+		return fmt.Errorf("informer caches not synced yet")
+	}
+	if !c.shardSynced() {
+		return fmt.Errorf("shard membership not known yet")
+	}
 	return nil
 }
 
+// shardSynced reports whether the shard membership is known. It is always
+// true when sharding is disabled.
+func (c *Controller) shardSynced() bool {
+	return c.sharder == nil || c.sharder.HasSynced()
+}
+
+// SetRateLimit changes the overall rate of the workqueue retries.
+func (c *Controller) SetRateLimit(qps float32, burst int32) {
+	c.bucketLimiter.SetLimit(rate.Limit(qps))
+	c.bucketLimiter.SetBurst(int(burst))
+}
+
+// SetEnvoyDefaults changes the defaults used for the envoy proxies created
+// from now on.
+func (c *Controller) SetEnvoyDefaults(envoy configv1alpha1.EnvoyConfiguration) {
+	c.envoyDefaults.Store(&envoy)
+}
+
+// Watchdog returns a liveness check that fails when an item has been waiting
+// in the workqueue for longer than timeout and no worker has finished an
+// item in that time either. This catches both a cache sync that never
+// completes and wedged workers, without failing on the first item queued
+// after an idle period. The check passes until Run is called: a standby
+// replica is not expected to make progress.
+func (c *Controller) Watchdog(timeout time.Duration) func(*http.Request) error {
+	return func(*http.Request) error {
+		if !c.running.Load() {
+			return nil
+		}
+		oldest, ok := c.workqueue.OldestAdded()
+		if !ok {
+			return nil
+		}
+		stalledSince := time.Unix(0, c.lastProgress.Load())
+		if oldest.After(stalledSince) {
+			stalledSince = oldest
+		}
+		if stalled := time.Since(stalledSince); stalled > timeout {
+			return fmt.Errorf("%d items queued but no progress for %s", c.workqueue.Len(), stalled.Round(time.Second))
+		}
+		return nil
+	}
+}
+
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
@@ -215,7 +572,15 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	defer c.workqueue.Done(objRef)
 
 	// Run the syncHandler, passing it the structured reference to the object to be synced.
-	err := c.syncHandler(ctx, objRef)
+	start := time.Now()
+	err := c.reconcile(ctx, objRef)
+	c.lastProgress.Store(time.Now().UnixNano())
+	result := metrics.ResultSuccess
+	if err != nil {
+		result = metrics.ResultError
+	}
+	metrics.ReconcileDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	metrics.ReconcileTotal.WithLabelValues(result).Inc()
 	if err == nil {
 		// If no error occurs then we Forget this item so it does not
 		// get queued again until another change happens.
@@ -223,10 +588,33 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 		logger.Info("Successfully synced", "objectName", objRef)
 		return true
 	}
-	// there was a failure so be sure to report it.  This method allows for
-	// pluggable error handling which can be used for things like
-	// cluster-monitoring.
-	utilruntime.HandleErrorWithContext(ctx, err, "Error syncing; requeuing for later retry", "objectReference", objRef)
+
+	class := classify(err)
+	if class == classTerminal {
+		utilruntime.HandleErrorWithContext(ctx, err, "Error syncing; not retrying until the book changes", "objectReference", objRef)
+		c.workqueue.Forget(objRef)
+		c.markDegraded(ctx, objRef, terminalReason(err), err)
+		return true
+	}
+	if c.workqueue.NumRequeues(objRef) >= c.maxRetries {
+		// The retries start over on the next change of the Book; until
+		// then the Degraded condition reports the failure.
+		utilruntime.HandleErrorWithContext(ctx, err, "Error syncing; giving up", "objectReference", objRef, "retries", c.maxRetries)
+		c.workqueue.Forget(objRef)
+		c.markDegraded(ctx, objRef, ReasonRetriesExhausted, err)
+		return true
+	}
+	if class == classConflict {
+		// The write was based on a stale object. The next attempt reads it
+		// again; the first retries come after the short base delay, a
+		// conflict that persists backs off like any other error.
+		logger.V(4).Info("Conflict syncing; requeuing", "objectName", objRef, "err", err)
+	} else {
+		// there was a failure so be sure to report it.  This method allows for
+		// pluggable error handling which can be used for things like
+		// cluster-monitoring.
+		utilruntime.HandleErrorWithContext(ctx, err, "Error syncing; requeuing for later retry", "objectReference", objRef)
+	}
 	// since we failed, we should requeue the item to work on later.  This
 	// method will add a backoff to avoid hotlooping on particular items
 	// (they're probably still not going to work right away) and overall
@@ -236,10 +624,31 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	return true
 }
 
+// reconcile runs syncHandler with the reconcile deadline. A panic is
+// recovered and turned into a terminal error, so that a single broken Book
+// neither takes the process down nor stops the worker.
+func (c *Controller) reconcile(ctx context.Context, objectRef cache.ObjectName) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.reconcileTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			metrics.ReconcilePanics.Inc()
+			klog.FromContext(ctx).Error(nil, "Recovered from panic while syncing", "objectReference", objectRef, "panic", r, "stack", string(debug.Stack()))
+			err = &TerminalError{Reason: ReasonReconcilePanic, Err: fmt.Errorf("panic while syncing: %v", r)}
+		}
+	}()
+	return c.syncHandler(ctx, objectRef)
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the book resource
 // with the current status of the resource.
-func (c *Controller) syncHandler(ctx context.Context, objectRef cache.ObjectName) error {
+func (c *Controller) syncHandler(ctx context.Context, objectRef cache.ObjectName) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "syncHandler", trace.WithAttributes(
+		attribute.String("book.namespace", objectRef.Namespace),
+		attribute.String("book.name", objectRef.Name),
+	))
+	defer func() { endSpan(span, err) }()
 	logger := klog.LoggerWithValues(klog.FromContext(ctx), "objectRef", objectRef)
 
 	// Get the book resource with this namespace/name
@@ -249,163 +658,557 @@ func (c *Controller) syncHandler(ctx context.Context, objectRef cache.ObjectName
 		// processing.
 		if errors.IsNotFound(err) {
 			utilruntime.HandleErrorWithContext(ctx, err, "Book referenced by item in work queue no longer exists", "objectReference", objectRef)
+			metrics.BookAvailableReplicas.DeleteLabelValues(objectRef.Namespace, objectRef.Name)
+			c.forgetEnvoyReport(objectRef)
 			return nil
 		}
 
 		return err
 	}
+	span.SetAttributes(attribute.Int64("book.generation", book.Generation))
+
+	// The shard membership may have changed since the Book was queued, in
+	// which case another replica is now responsible for it.
+	if c.sharder != nil && !c.sharder.Owns(objectRef) {
+		logger.V(4).Info("Skipping book owned by another shard")
+		return nil
+	}
 
-	deploymentName := book.Spec.DeploymentName
-	if deploymentName == "" {
-		// We choose to absorb the error here as the worker would requeue the
-		// resource otherwise. Instead, the next time the resource is updated
-		// the resource will be queued again.
-		utilruntime.HandleErrorWithContext(ctx, nil, "Deployment name missing from object reference", "objectReference", objectRef)
+	// A terminal error is not retried until the spec of the Book changes or
+	// a sync is requested through the reconcile-at annotation. A missing
+	// key set is looked for again when it is created, see pollJWKS.
+	if degraded := meta.FindStatusCondition(book.Status.Conditions, bookv1.ConditionDegraded); degraded != nil &&
+		degraded.Status == metav1.ConditionTrue && degraded.Reason != ReasonRetriesExhausted && degraded.Reason != ReasonJWKSNotFound &&
+		degraded.ObservedGeneration == book.Generation &&
+		book.Status.LastHandledReconcileAt == book.Annotations[bookv1.ReconcileAtAnnotation] {
+		logger.V(4).Info("Skipping degraded book until its spec changes", "reason", degraded.Reason)
 		return nil
 	}
 
+	if book.Spec.DeploymentName == "" {
+		return terminalf(ReasonInvalidSpec, "spec.deploymentName must not be empty")
+	}
+	// The first port is the one served by the Service and by envoy. The CRD
+	// requires one, but a Book stored before that may have none.
+	if len(book.Spec.Container.Ports) == 0 {
+		return terminalf(ReasonInvalidSpec, "spec.container.ports must list at least one port")
+	}
+
+	tls, err := c.syncCertificates(ctx, book)
+	if err != nil {
+		return err
+	}
+	idle := c.isIdle(book)
+	deployment, err := c.syncDeployment(ctx, book, replicas(book, idle), tls)
+	if err != nil {
+		return err
+	}
+	if err := c.syncService(ctx, book); err != nil {
+		return err
+	}
+	if err := c.syncHeadlessService(ctx, book); err != nil {
+		return err
+	}
+	mirror, mirrorReady, err := c.envoyMirror(book)
+	if err != nil {
+		return err
+	}
+	configHash, err := c.syncEnvoyConfigMap(ctx, book, tls, mirror)
+	if err != nil {
+		return err
+	}
+	if err := c.syncEnvoyDeployment(ctx, book, configHash); err != nil {
+		return err
+	}
+	if err := c.syncEnvoyService(ctx, book); err != nil {
+		return err
+	}
+
+	// Finally, we update the status block of the book resource to reflect the
+	// current state of the world
+	err = c.updateBookStatus(ctx, book, deployment, idleCondition(book, idle), mirrorReady, tls)
+	if err != nil {
+		return err
+	}
+	if tls != nil {
+		c.scheduleRenewal(objectRef, tls.status.RenewAt.Time)
+	}
+
+	c.event(ctx, book, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	return nil
+}
+
+// syncDeployment makes sure the book-server Deployment exists and matches the
+// Book spec.
+func (c *Controller) syncDeployment(ctx context.Context, book *bookv1.Book, replicas *int32, tls *tlsSecrets) (deployment *appsv1.Deployment, err error) {
+	ctx, span := startStep(ctx, "Deployment")
+	defer func() { endSpan(span, err) }()
+	logger := klog.FromContext(ctx)
+
 	// Get the deployment with the name specified in book.spec
-	deployment, err := c.deploymentsLister.Deployments(book.Namespace).Get(deploymentName)
+	deployment, err = c.deploymentsLister.Deployments(book.Namespace).Get(book.Spec.DeploymentName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		deployment, err = c.kubeclientset.AppsV1().Deployments(book.Namespace).Create(ctx, newDeployment(book), metav1.CreateOptions{FieldManager: FieldManager})
+		deployment, err = c.createDeployment(ctx, book, newDeployment(book, replicas, tls))
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
 	// temporary network failure, or any other transient reason.
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// If the Deployment is not controlled by this book resource, we should log
-	// a warning to the event recorder and return error msg.
+	// If the Deployment is not controlled by this book resource, we return a
+	// terminal error. The Book is marked Degraded and a warning is recorded
+	// to the event recorder.
 	if !metav1.IsControlledBy(deployment, book) {
-		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
-		c.recorder.Event(book, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf("%s", msg)
+		return nil, terminalf(ErrResourceExists, MessageResourceExists, deployment.Name)
 	}
 
 	// If this number of the replicas on the book resource is specified, and the
 	// number does not equal the current desired replicas on the Deployment, we
 	// should update the Deployment resource.
 	// TODO: need to add more logic to make deployment update decision
-	if (book.Spec.Replicas != nil && *book.Spec.Replicas != *deployment.Spec.Replicas) ||
+	if (replicas != nil && *replicas != *deployment.Spec.Replicas) ||
 		(book.Spec.Container.Image != "" && book.Spec.Container.Image != deployment.Spec.Template.Spec.Containers[0].Image ||
-			(book.Spec.Container.Ports[0].ContainerPort != deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort)) {
-		logger.V(4).Info("Update deployment resource", "currentReplicas", *deployment.Spec.Replicas, "desiredReplicas", *book.Spec.Replicas)
-		deployment, err = c.kubeclientset.AppsV1().Deployments(book.Namespace).Update(ctx, newDeployment(book), metav1.UpdateOptions{FieldManager: FieldManager})
+			(book.Spec.Container.Ports[0].ContainerPort != deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort)) ||
+		(book.Spec.Container.ReadinessProbe == nil &&
+			!equality.Semantic.DeepEqual(readinessProbe(book), deployment.Spec.Template.Spec.Containers[0].ReadinessProbe)) ||
+		deployment.Spec.Template.Annotations[TLSHashAnnotation] != tls.hash() {
+		logger.V(4).Info("Update deployment resource", "currentReplicas", *deployment.Spec.Replicas, "desiredReplicas", replicas)
+		current := deployment
+		deployment, err = c.kubeclientset.AppsV1().Deployments(book.Namespace).Update(ctx, newDeployment(book, replicas, tls), c.updateOptions())
+		recordChildOperation("Deployment", metrics.OperationUpdate, err)
+		if err == nil {
+			c.recordChange(ctx, "Deployment", metrics.OperationUpdate, current, deployment)
+		}
 	}
 
 	// If an error occurs during Update, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
 	// temporary network failure, or any other transient reason.
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return deployment, nil
+}
+
+// createDeployment creates deployment for book. A Deployment of that name
+// may already exist without being in the cache, because the cache only holds
+// labeled Deployments. If the existing one belongs to book, its labels are
+// completed so that the informer picks it up. Otherwise it is returned as
+// is, and the caller reports the conflict.
+func (c *Controller) createDeployment(ctx context.Context, book *bookv1.Book, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	deployments := c.kubeclientset.AppsV1().Deployments(book.Namespace)
+	created, err := deployments.Create(ctx, deployment, c.createOptions())
+	recordChildOperation("Deployment", metrics.OperationCreate, err)
+	if err == nil {
+		c.recordChange(ctx, "Deployment", metrics.OperationCreate, nil, created)
+	}
+	if !errors.IsAlreadyExists(err) {
+		return created, err
 	}
 
-	svcName := book.Spec.DeploymentName + "service"
-	_, err = c.serviceLister.Services(objectRef.Namespace).Get(svcName)
+	existing, err := deployments.Get(ctx, deployment.Name, metav1.GetOptions{})
+	if err != nil || !metav1.IsControlledBy(existing, book) || labels.SelectorFromSet(childLabels(book)).Matches(labels.Set(existing.Labels)) {
+		return existing, err
+	}
+	labeled := existing.DeepCopy()
+	if labeled.Labels == nil {
+		labeled.Labels = map[string]string{}
+	}
+	for key, value := range childLabels(book) {
+		labeled.Labels[key] = value
+	}
+	adopted, err := deployments.Update(ctx, labeled, c.updateOptions())
+	recordChildOperation("Deployment", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "Deployment", metrics.OperationUpdate, existing, adopted)
+	}
+	return adopted, err
+}
+
+// syncService makes sure the Service in front of the book-server exists and
+// is up to date.
+func (c *Controller) syncService(ctx context.Context, book *bookv1.Book) (err error) {
+	ctx, span := startStep(ctx, "Service")
+	defer func() { endSpan(span, err) }()
+
+	svcName := serviceName(book)
+	current, err := c.serviceLister.Services(book.Namespace).Get(svcName)
 	if errors.IsNotFound(err) {
-		_, err := c.kubeclientset.CoreV1().Services(objectRef.Namespace).Create(ctx, newService(book), metav1.CreateOptions{})
-		if err != nil {
+		created, err := c.kubeclientset.CoreV1().Services(book.Namespace).Create(ctx, newService(book), c.createOptions())
+		recordChildOperation("Service", metrics.OperationCreate, err)
+		if err == nil {
+			c.recordChange(ctx, "Service", metrics.OperationCreate, nil, created)
+			return nil
+		}
+		// A Service created before the children were labeled is missing
+		// from the cache; the update below labels it.
+		if !errors.IsAlreadyExists(err) {
 			return err
 		}
 	} else if err != nil {
 		return err
 	}
 	// TODO: need to add some checks before updating the service
-	_, err = c.kubeclientset.CoreV1().Services(objectRef.Namespace).Update(ctx, newService(book), metav1.UpdateOptions{})
+	updated, err := c.kubeclientset.CoreV1().Services(book.Namespace).Update(ctx, newService(book), c.updateOptions())
+	recordChildOperation("Service", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "Service", metrics.OperationUpdate, current, updated)
+	}
+	return err
+}
+
+// syncHeadlessService makes sure the headless Service resolving to the
+// book-server pods, which envoy balances between, exists and is up to date.
+func (c *Controller) syncHeadlessService(ctx context.Context, book *bookv1.Book) (err error) {
+	ctx, span := startStep(ctx, "HeadlessService")
+	defer func() { endSpan(span, err) }()
+
+	desired := newHeadlessService(book)
+	current, err := c.serviceLister.Services(book.Namespace).Get(desired.Name)
+	if errors.IsNotFound(err) {
+		created, err := c.kubeclientset.CoreV1().Services(book.Namespace).Create(ctx, desired, c.createOptions())
+		recordChildOperation("Service", metrics.OperationCreate, err)
+		if err == nil {
+			c.recordChange(ctx, "Service", metrics.OperationCreate, nil, created)
+		}
+		return err
+	}
 	if err != nil {
 		return err
 	}
+	if !metav1.IsControlledBy(current, book) {
+		return terminalf(ErrResourceExists, MessageResourceExists, current.Name)
+	}
+	if equality.Semantic.DeepEqual(current.Spec.Selector, desired.Spec.Selector) &&
+		equality.Semantic.DeepEqual(current.Spec.Ports, desired.Spec.Ports) {
+		return nil
+	}
+	updated := current.DeepCopy()
+	updated.Spec.Selector = desired.Spec.Selector
+	updated.Spec.Ports = desired.Spec.Ports
+	updated, err = c.kubeclientset.CoreV1().Services(book.Namespace).Update(ctx, updated, c.updateOptions())
+	recordChildOperation("Service", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "Service", metrics.OperationUpdate, current, updated)
+	}
+	return err
+}
 
-	envoyConfigMapName := book.Spec.DeploymentName + "-envoy-config"
-	envoyConfigMap, err := c.kubeclientset.CoreV1().ConfigMaps(book.Namespace).Get(ctx, envoyConfigMapName, metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		envoyConfigMap, err = c.kubeclientset.CoreV1().ConfigMaps(book.Namespace).Create(ctx, newEnvoyConfigMap(book), metav1.CreateOptions{FieldManager: FieldManager})
+// syncEnvoyConfigMap makes sure the ConfigMap holding the envoy
+// configuration exists and is up to date. It returns the hash of the
+// configuration.
+func (c *Controller) syncEnvoyConfigMap(ctx context.Context, book *bookv1.Book, tls *tlsSecrets, mirror *envoy.Mirror) (hash string, err error) {
+	ctx, span := startStep(ctx, "EnvoyConfigMap")
+	defer func() { endSpan(span, err) }()
+
+	desired, err := newEnvoyConfigMap(book, *c.envoyDefaults.Load(), mirror)
+	if err != nil {
+		return "", err
+	}
+	jwks, err := c.jwksData(ctx, book)
+	if err != nil {
+		return "", err
+	}
+	hashed := map[string]string{}
+	for key, value := range desired.Data {
+		hashed[key] = value
 	}
+	for provider, value := range jwks {
+		hashed["jwks/"+provider] = value
+	}
+	if tls != nil {
+		// Envoy reads its certificate once as well.
+		hashed["tls"] = tls.envoyHash
+	}
+	hash = configHash(hashed)
 
+	configMaps := c.kubeclientset.CoreV1().ConfigMaps(book.Namespace)
+	envoyConfigMap, err := configMaps.Get(ctx, desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		envoyConfigMap, err = configMaps.Create(ctx, desired, c.createOptions())
+		recordChildOperation("ConfigMap", metrics.OperationCreate, err)
+		if err == nil {
+			c.recordChange(ctx, "ConfigMap", metrics.OperationCreate, nil, envoyConfigMap)
+		}
+		return hash, err
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if !metav1.IsControlledBy(envoyConfigMap, book) {
-		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
-		c.recorder.Event(book, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf("%s", msg)
+		return "", terminalf(ErrResourceExists, MessageResourceExists, envoyConfigMap.Name)
+	}
+	if equality.Semantic.DeepEqual(envoyConfigMap.Data, desired.Data) {
+		return hash, nil
+	}
+	updated, err := configMaps.Update(ctx, desired, c.updateOptions())
+	recordChildOperation("ConfigMap", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "ConfigMap", metrics.OperationUpdate, envoyConfigMap, updated)
 	}
+	return hash, err
+}
+
+// syncEnvoyDeployment makes sure the envoy Deployment exists and runs the
+// configuration of the given hash.
+func (c *Controller) syncEnvoyDeployment(ctx context.Context, book *bookv1.Book, configHash string) (err error) {
+	ctx, span := startStep(ctx, "EnvoyDeployment")
+	defer func() { endSpan(span, err) }()
 
 	envoyDeploymentName := book.Spec.DeploymentName + "-envoy"
+	desired := newEnvoyDeployment(book, *c.envoyDefaults.Load(), configHash)
 
 	envoyDeployment, err := c.deploymentsLister.Deployments(book.Namespace).Get(envoyDeploymentName)
 	if errors.IsNotFound(err) {
-		envoyDeployment, err = c.kubeclientset.AppsV1().Deployments(book.Namespace).Create(ctx, newEnvoyDeployment(book), metav1.CreateOptions{FieldManager: FieldManager})
+		envoyDeployment, err = c.createDeployment(ctx, book, desired)
 	}
-	// TODO: need to decide when we may need to update Envoy Deployment
 
 	if err != nil {
 		return err
 	}
 
 	if !metav1.IsControlledBy(envoyDeployment, book) {
-		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
-		c.recorder.Event(book, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf("%s", msg)
+		return terminalf(ErrResourceExists, MessageResourceExists, envoyDeployment.Name)
 	}
 
+	// Envoy does not reload its bootstrap configuration, a change of the
+	// configuration rolls the pods out.
+	if envoyDeployment.Spec.Template.Annotations[EnvoyConfigHashAnnotation] == configHash {
+		return nil
+	}
+	updated, err := c.kubeclientset.AppsV1().Deployments(book.Namespace).Update(ctx, desired, c.updateOptions())
+	recordChildOperation("Deployment", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "Deployment", metrics.OperationUpdate, envoyDeployment, updated)
+	}
+	return err
+}
+
+// syncEnvoyService makes sure the LoadBalancer Service in front of envoy
+// exists and is up to date.
+func (c *Controller) syncEnvoyService(ctx context.Context, book *bookv1.Book) (err error) {
+	ctx, span := startStep(ctx, "EnvoyService")
+	defer func() { endSpan(span, err) }()
+
 	envoySvcName := book.Spec.DeploymentName + "-envoy-service"
-	_, err = c.serviceLister.Services(objectRef.Namespace).Get(envoySvcName)
+	current, err := c.serviceLister.Services(book.Namespace).Get(envoySvcName)
 	if errors.IsNotFound(err) {
-		_, err := c.kubeclientset.CoreV1().Services(objectRef.Namespace).Create(ctx, newEnvoyService(book), metav1.CreateOptions{})
-		if err != nil {
+		created, err := c.kubeclientset.CoreV1().Services(book.Namespace).Create(ctx, newEnvoyService(book), c.createOptions())
+		recordChildOperation("Service", metrics.OperationCreate, err)
+		if err == nil {
+			c.recordChange(ctx, "Service", metrics.OperationCreate, nil, created)
+			return nil
+		}
+		// A Service created before the children were labeled is missing
+		// from the cache; the update below labels it.
+		if !errors.IsAlreadyExists(err) {
 			return err
 		}
 	} else if err != nil {
 		return err
 	}
 	// TODO: need to add some checks before updating the service
-	_, err = c.kubeclientset.CoreV1().Services(objectRef.Namespace).Update(ctx, newEnvoyService(book), metav1.UpdateOptions{})
+	updated, err := c.kubeclientset.CoreV1().Services(book.Namespace).Update(ctx, newEnvoyService(book), c.updateOptions())
+	recordChildOperation("Service", metrics.OperationUpdate, err)
+	if err == nil {
+		c.recordChange(ctx, "Service", metrics.OperationUpdate, current, updated)
+	}
+	return err
+}
 
+// enqueueBook takes a Book resource and converts it into a namespace/name
+// string which is then put onto the work queue with the given priority. This
+// method should *not* be passed resources of any type other than Book, or
+// tombstones of Books.
+func (c *Controller) enqueueBook(obj interface{}, priority priorityqueue.Priority) {
+	if objectRef, err := cache.DeletionHandlingObjectToName(obj); err != nil {
+		utilruntime.HandleError(err)
+		return
+	} else if c.sharder == nil || c.sharder.Owns(objectRef) {
+		c.workqueue.Add(objectRef, priority)
+	}
+}
+
+// enqueueResync enqueues a Book replayed by the periodic resync with the Low
+// priority, after a random delay of up to half the resync period so that the
+// Books are not all synced at once.
+func (c *Controller) enqueueResync(obj interface{}) {
+	objectRef, err := cache.ObjectToName(obj)
 	if err != nil {
-		return err
+		utilruntime.HandleError(err)
+		return
+	}
+	var jitter time.Duration
+	if c.resyncPeriod > 1 {
+		jitter = time.Duration(rand.Int64N(int64(c.resyncPeriod / 2)))
 	}
+	c.workqueue.AddAfter(objectRef, jitter, priorityqueue.Low)
+}
 
-	// Finally, we update the status block of the book resource to reflect the
-	// current state of the world
-	err = c.updateBookStatus(ctx, book, deployment)
+// scheduleRenewal queues the Book objectRef again at renewAt, so that its
+// certificates are renewed on time even with a long resync period. A Book
+// is only scheduled when no resync comes first: the sync of that resync
+// schedules it instead. The queue keeps a single deadline per Book, so a
+// Book synced again before renewAt does not add a timer.
+func (c *Controller) scheduleRenewal(objectRef cache.ObjectName, renewAt time.Time) {
+	delay := renewAt.Sub(c.clock.Now())
+	if c.resyncPeriod > 0 && delay > c.resyncPeriod {
+		return
+	}
+	c.workqueue.AddAfter(objectRef, delay, priorityqueue.Low)
+}
+
+// requestReconcile enqueues a Book whose sync was requested through the
+// reconcile-at annotation. The backoff and the retries of the Book start
+// over, so the sync runs right away.
+func (c *Controller) requestReconcile(obj interface{}) {
+	objectRef, err := cache.ObjectToName(obj)
 	if err != nil {
-		return err
+		utilruntime.HandleError(err)
+		return
 	}
+	c.workqueue.Forget(objectRef)
+	c.workqueue.Add(objectRef, priorityqueue.High)
+}
 
-	c.recorder.Event(book, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	return nil
+// ownsObject reports whether obj belongs to the shard of this replica. It
+// accepts everything when sharding is disabled.
+func (c *Controller) ownsObject(obj interface{}) bool {
+	if c.sharder == nil {
+		return true
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	objectRef, err := cache.ObjectToName(obj)
+	if err != nil {
+		return false
+	}
+	return c.sharder.Owns(objectRef)
 }
 
-// enqueueBook takes a Book resource and converts it into a namespace/name
-// string which is then put onto the work queue. This method should *not* be
-// passed resources of any type other than Book.
-func (c *Controller) enqueueBook(obj interface{}) {
-	if objectRef, err := cache.ObjectToName(obj); err != nil {
+// Rebalance enqueues every Book that belongs to this replica. It is called
+// when the shard membership changes so that Books taken over from a replica
+// that went away are synced without waiting for the next resync.
+func (c *Controller) Rebalance() {
+	books, err := c.bookLister.List(labels.Everything())
+	if err != nil {
 		utilruntime.HandleError(err)
 		return
-	} else {
-		c.workqueue.Add(objectRef)
+	}
+	for _, book := range books {
+		c.enqueueBook(book, priorityqueue.Normal)
 	}
 }
 
-func (c *Controller) updateBookStatus(ctx context.Context, book *bookv1.Book, deployment *appsv1.Deployment) error {
+func (c *Controller) updateBookStatus(ctx context.Context, book *bookv1.Book, deployment *appsv1.Deployment, idle, mirrorReady *metav1.Condition, tls *tlsSecrets) (err error) {
+	ctx, span := startStep(ctx, "Status")
+	defer func() { endSpan(span, err) }()
+
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	bookCopy := book.DeepCopy()
 	bookCopy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
+	if c.sharder != nil {
+		bookCopy.Status.Shard = c.sharder.ID()
+	}
+	bookCopy.Status.LastHandledReconcileAt = book.Annotations[bookv1.ReconcileAtAnnotation]
+	bookCopy.Status.Rollout = rolloutStatus(deployment)
+	bookCopy.Status.TLS = nil
+	if tls != nil {
+		bookCopy.Status.TLS = tls.status
+	}
+	bookCopy.Status.PodIssues, err = c.podIssues(book)
+	if err != nil {
+		return err
+	}
+	if report, ok := c.envoyReportFor(cache.MetaObjectToName(book)); ok {
+		bookCopy.Status.Envoy = report.status
+		condition := report.condition
+		condition.ObservedGeneration = book.Generation
+		meta.SetStatusCondition(&bookCopy.Status.Conditions, condition)
+	}
+	if idle != nil {
+		meta.SetStatusCondition(&bookCopy.Status.Conditions, *idle)
+	} else {
+		meta.RemoveStatusCondition(&bookCopy.Status.Conditions, bookv1.ConditionIdle)
+	}
+	if mirrorReady != nil {
+		meta.SetStatusCondition(&bookCopy.Status.Conditions, *mirrorReady)
+	} else {
+		meta.RemoveStatusCondition(&bookCopy.Status.Conditions, bookv1.ConditionMirrorReady)
+	}
+	meta.SetStatusCondition(&bookCopy.Status.Conditions, metav1.Condition{
+		Type:               bookv1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             SuccessSynced,
+		Message:            MessageResourceSynced,
+		ObservedGeneration: book.Generation,
+	})
+	if c.dryRun != nil {
+		klog.FromContext(ctx).V(4).Info("Dry run: skipping status update")
+		return nil
+	}
 	// If the CustomResourceSubresources feature gate is not enabled,
 	// we must use Update instead of UpdateStatus to update the Status block of the book resource.
 	// UpdateStatus will not allow changes to the Spec of the resource,
 	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err := c.sampleclientset.SimplecustomcontrollerV1().Books(book.Namespace).UpdateStatus(ctx, bookCopy, metav1.UpdateOptions{FieldManager: FieldManager})
-	return err
+	_, err = c.sampleclientset.SimplecustomcontrollerV1().Books(book.Namespace).UpdateStatus(ctx, bookCopy, metav1.UpdateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return err
+	}
+	// The failure is reported once the status that remembers it is stored.
+	if rolloutJustFailed(book.Status.Rollout, bookCopy.Status.Rollout) {
+		c.event(ctx, book, corev1.EventTypeWarning, ReasonRolloutFailed,
+			fmt.Sprintf("Rollout of revision %s of Deployment %s failed: %s", bookCopy.Status.Rollout.Revision, deployment.Name, bookCopy.Status.Rollout.Message))
+	}
+	if mirrorJustFailed(book.Status.Conditions, mirrorReady) {
+		c.event(ctx, book, corev1.EventTypeWarning, mirrorReady.Reason, mirrorReady.Message)
+	}
+	metrics.BookAvailableReplicas.WithLabelValues(book.Namespace, book.Name).Set(float64(bookCopy.Status.AvailableReplicas))
+	return nil
+}
+
+// markDegraded sets the Degraded condition of the Book after a sync failure
+// that is not retried, and records an Event the first time.
+func (c *Controller) markDegraded(ctx context.Context, objectRef cache.ObjectName, reason string, syncErr error) {
+	book, err := c.bookLister.Books(objectRef.Namespace).Get(objectRef.Name)
+	if err != nil {
+		return
+	}
+	bookCopy := book.DeepCopy()
+	// The requested sync is handled, even though it failed.
+	requested := book.Annotations[bookv1.ReconcileAtAnnotation]
+	changed := bookCopy.Status.LastHandledReconcileAt != requested
+	bookCopy.Status.LastHandledReconcileAt = requested
+	changed = meta.SetStatusCondition(&bookCopy.Status.Conditions, metav1.Condition{
+		Type:               bookv1.ConditionDegraded,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            syncErr.Error(),
+		ObservedGeneration: book.Generation,
+	}) || changed
+	if !changed || c.dryRun != nil {
+		return
+	}
+	c.event(ctx, book, corev1.EventTypeWarning, reason, syncErr.Error())
+	_, err = c.sampleclientset.SimplecustomcontrollerV1().Books(book.Namespace).UpdateStatus(ctx, bookCopy, metav1.UpdateOptions{FieldManager: FieldManager})
+	if err != nil {
+		utilruntime.HandleErrorWithContext(ctx, err, "Error marking book degraded", "objectReference", objectRef)
+	}
+}
+
+// recordChildOperation counts a successful write to an object owned by a Book.
+func recordChildOperation(kind, operation string, err error) {
+	if err == nil {
+		metrics.ChildOperations.WithLabelValues(kind, operation).Inc()
+	}
 }
 
 // handleObject will take any resource implementing metav1.Object and attempt
@@ -413,7 +1216,7 @@ func (c *Controller) updateBookStatus(ctx context.Context, book *bookv1.Book, de
 // objects metadata.ownerReferences field for an appropriate OwnerReference.
 // It then enqueues that book resource to be processed. If the object does not
 // have an appropriate OwnerReference, it will simply be skipped.
-func (c *Controller) handleObject(obj interface{}) {
+func (c *Controller) handleObject(obj interface{}, priority priorityqueue.Priority) {
 	var object metav1.Object
 	var ok bool
 	logger := klog.FromContext(context.Background())
@@ -446,55 +1249,76 @@ func (c *Controller) handleObject(obj interface{}) {
 			logger.V(4).Info("Ignore orphaned object", "object", klog.KObj(object), "book", ownerRef.Name)
 			return
 		}
-		c.enqueueBook(book)
+		c.enqueueBook(book, priority)
 		return
 	}
 }
 
+// childLabels returns the labels set on every object created for book.
+func childLabels(book *bookv1.Book) map[string]string {
+	return map[string]string{
+		ManagedByLabel: ManagedByValue,
+		BookLabel:      book.Name,
+	}
+}
+
 // newDeployment creates a new Deployment for a book resource. It also sets
 // the appropriate OwnerReferences on the resource so handleObject can discover
 // the book resource that 'owns' it.
-func newDeployment(book *bookv1.Book) *appsv1.Deployment {
+func newDeployment(book *bookv1.Book, replicas *int32, tls *tlsSecrets) *appsv1.Deployment {
 	labels := map[string]string{
 		"app":        "book-server",
 		"controller": book.Name,
 	}
+	container := *book.Spec.Container.DeepCopy()
+	container.ReadinessProbe = readinessProbe(book)
+	volumes, mounts := tlsVolumes(book, serverSecretName(book), ServerTLSDir)
+	container.VolumeMounts = append(container.VolumeMounts, mounts...)
+	var annotations map[string]string
+	if tls != nil {
+		// The book-server is not expected to reload its certificate.
+		annotations = map[string]string{TLSHashAnnotation: tls.serverHash}
+	}
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      book.Spec.DeploymentName,
 			Namespace: book.Namespace,
+			Labels:    childLabels(book),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: book.Spec.Replicas,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: annotations,
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
-						book.Spec.Container,
+						container,
 					},
+					Volumes: volumes,
 				},
 			},
 		},
 	}
 }
 
-func newEnvoyDeployment(book *bookv1.Book) *appsv1.Deployment {
+func newEnvoyDeployment(book *bookv1.Book, defaults configv1alpha1.EnvoyConfiguration, configHash string) *appsv1.Deployment {
 	labels := map[string]string{
 		"app":        "envoy",
 		"controller": book.Name,
 	}
-	return &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      book.Spec.DeploymentName + "-envoy",
 			Namespace: book.Namespace,
+			Labels:    childLabels(book),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
 			},
@@ -507,20 +1331,23 @@ func newEnvoyDeployment(book *bookv1.Book) *appsv1.Deployment {
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						EnvoyConfigHashAnnotation: configHash,
+					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
 							Name:  book.Spec.DeploymentName + "-envoy",
-							Image: "envoyproxy/envoy:v1.32.3",
+							Image: defaults.Image,
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "http",
-									ContainerPort: 1999,
+									ContainerPort: envoyListenPort,
 								},
 								{
 									Name:          "admin",
-									ContainerPort: 8001,
+									ContainerPort: envoyAdminPort,
 								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
@@ -547,6 +1374,12 @@ func newEnvoyDeployment(book *bookv1.Book) *appsv1.Deployment {
 			},
 		},
 	}
+	volumes, mounts := jwksVolumes(book)
+	tlsVolumes, tlsMounts := tlsVolumes(book, envoySecretName(book), envoy.TLSDir)
+	podSpec := &deployment.Spec.Template.Spec
+	podSpec.Volumes = append(append(podSpec.Volumes, volumes...), tlsVolumes...)
+	podSpec.Containers[0].VolumeMounts = append(append(podSpec.Containers[0].VolumeMounts, mounts...), tlsMounts...)
+	return deployment
 }
 
 func newService(book *bookv1.Book) *corev1.Service {
@@ -554,12 +1387,14 @@ func newService(book *bookv1.Book) *corev1.Service {
 		"app":        "book-server",
 		"controller": book.Name,
 	}
+	appProtocol := serviceAppProtocol(servedProtocol(book), mutualTLS(book))
 	return &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "Service",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: book.Spec.DeploymentName + "service",
+			Name:   serviceName(book),
+			Labels: childLabels(book),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
 			},
@@ -569,15 +1404,40 @@ func newService(book *bookv1.Book) *corev1.Service {
 			Selector: labels,
 			Ports: []corev1.ServicePort{
 				{
-					Port:       book.Spec.Container.Ports[0].ContainerPort,
-					TargetPort: intstr.FromInt32(book.Spec.Container.Ports[0].ContainerPort),
-					NodePort:   30009,
+					Port:        book.Spec.Container.Ports[0].ContainerPort,
+					TargetPort:  intstr.FromInt32(book.Spec.Container.Ports[0].ContainerPort),
+					NodePort:    30009,
+					AppProtocol: &appProtocol,
 				},
 			},
 		},
 	}
 }
 
+// serviceName is the name of the Service of the book-server of book.
+func serviceName(book *bookv1.Book) string {
+	return book.Spec.DeploymentName + "service"
+}
+
+// headlessServiceName is the name of the headless Service of the book-server
+// of book.
+func headlessServiceName(book *bookv1.Book) string {
+	return book.Spec.DeploymentName + "-headless"
+}
+
+// newHeadlessService returns the headless Service of the book-server of
+// book. Its DNS name resolves to the ready pods, one envoy host each.
+func newHeadlessService(book *bookv1.Book) *corev1.Service {
+	service := newService(book)
+	service.Name = headlessServiceName(book)
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.Ports[0].NodePort = 0
+	// Set as the API server defaults it, for the comparison.
+	service.Spec.Ports[0].Protocol = corev1.ProtocolTCP
+	return service
+}
+
 func newEnvoyService(book *bookv1.Book) *corev1.Service {
 	labels := map[string]string{
 		"app":        "envoy",
@@ -588,7 +1448,8 @@ func newEnvoyService(book *bookv1.Book) *corev1.Service {
 			Kind: "Service",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: book.Spec.DeploymentName + "-envoy-service",
+			Name:   book.Spec.DeploymentName + "-envoy-service",
+			Labels: childLabels(book),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
 			},
@@ -598,36 +1459,32 @@ func newEnvoyService(book *bookv1.Book) *corev1.Service {
 			Selector: labels,
 			Ports: []corev1.ServicePort{
 				{
-					Port:       1999,
-					TargetPort: intstr.FromInt32(1999),
+					Port:       envoyListenPort,
+					TargetPort: intstr.FromInt32(envoyListenPort),
 				},
 			},
 		},
 	}
 }
 
-func newEnvoyConfigMap(book *bookv1.Book) *corev1.ConfigMap {
-	//labels := map[string]string{
-	//	"app":        "book-server",
-	//	"controller": book.Name,
-	//}
-	wd, _ := os.Getwd()
-	envoyConfig, err := os.ReadFile(wd + "/manifests/envoy.yaml")
+func newEnvoyConfigMap(book *bookv1.Book, defaults configv1alpha1.EnvoyConfiguration, mirror *envoy.Mirror) (*corev1.ConfigMap, error) {
+	config, err := envoyConfig(book, defaults, mirror)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 	return &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: book.Spec.DeploymentName + "-envoy-config",
+			Name:   book.Spec.DeploymentName + "-envoy-config",
+			Labels: childLabels(book),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
 			},
 		},
 		Data: map[string]string{
-			"envoy.yaml": string(envoyConfig),
+			"envoy.yaml": config,
 		},
-	}
+	}, nil
 }
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	bookfake "github.com/shiponcs/simple-custom-controller/pkg/generated/clientset/versioned/fake"
+	bookinformers "github.com/shiponcs/simple-custom-controller/pkg/generated/informers/externalversions"
+	listers "github.com/shiponcs/simple-custom-controller/pkg/generated/listers/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestWatchdog(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+	c := &Controller{workqueue: priorityqueue.New(workqueue.DefaultTypedControllerRateLimiter[cache.ObjectName](), priorityqueue.Config{})}
+	defer c.workqueue.ShutDown()
+	check := c.Watchdog(timeout)
+
+	// A standby replica lists the Books into its queue but runs no worker
+	// until it leads.
+	c.workqueue.Add(cache.NewObjectName("default", "book-api"), priorityqueue.Normal)
+	time.Sleep(2 * timeout)
+	if err := check(nil); err != nil {
+		t.Errorf("standby with queued Books: %v, want nil", err)
+	}
+
+	// The timeout starts over when Run is called.
+	c.lastProgress.Store(time.Now().UnixNano())
+	c.running.Store(true)
+	if err := check(nil); err != nil {
+		t.Errorf("leader right after Run: %v, want nil", err)
+	}
+	time.Sleep(2 * timeout)
+	if err := check(nil); err == nil {
+		t.Error("leader making no progress on a queued Book: nil, want an error")
+	}
+
+	// A Book queued after an idle period is not a stall.
+	item, _ := c.workqueue.Get()
+	c.workqueue.Done(item)
+	c.workqueue.Add(item, priorityqueue.Normal)
+	if err := check(nil); err != nil {
+		t.Errorf("leader with a freshly queued Book: %v, want nil", err)
+	}
+}
+
+// newInformerController returns a Controller fed by informers of fake API
+// servers holding books, and starts the informers.
+func newInformerController(t *testing.T, ctx context.Context, books ...runtime.Object) (*Controller, *bookfake.Clientset) {
+	t.Helper()
+	kubeClient := fake.NewSimpleClientset()
+	bookClient := bookfake.NewSimpleClientset(books...)
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	bookInformerFactory := bookinformers.NewSharedInformerFactory(bookClient, 0)
+	c := NewController(ctx, kubeClient, bookClient, []InformerSet{{
+		Namespace:   metav1.NamespaceAll,
+		Deployments: kubeInformerFactory.Apps().V1().Deployments(),
+		Services:    kubeInformerFactory.Core().V1().Services(),
+		Pods:        kubeInformerFactory.Core().V1().Pods(),
+		Books:       bookInformerFactory.Simplecustomcontroller().V1().Books(),
+	}}, Options{
+		RateLimiter: configv1alpha1.RateLimiterConfiguration{
+			QPS:        10,
+			Burst:      100,
+			BaseDelay:  metav1.Duration{Duration: 5 * time.Millisecond},
+			MaxDelay:   metav1.Duration{Duration: time.Second},
+			MaxRetries: 5,
+		},
+		ReconcileTimeout: 10 * time.Second,
+	})
+	t.Cleanup(c.workqueue.ShutDown)
+	kubeInformerFactory.Start(ctx.Done())
+	bookInformerFactory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.bookSynced, c.deploymentsSynced, c.serviceSynced, c.podsSynced) {
+		t.Fatal("informer caches did not sync")
+	}
+	return c, bookClient
+}
+
+func TestDeletedBookDropsMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	book := tlsBook()
+	c, bookClient := newInformerController(t, ctx, book)
+	objectRef := cache.MetaObjectToName(book)
+
+	// The Book was added to the queue by the informer; pretend it synced.
+	item, _ := c.workqueue.Get()
+	c.workqueue.Done(item)
+	c.workqueue.Forget(item)
+	metrics.BookAvailableReplicas.WithLabelValues(book.Namespace, book.Name).Set(1)
+	c.envoyHealth.reports[objectRef] = envoyReport{}
+
+	if err := bookClient.SimplecustomcontrollerV1().Books(book.Namespace).Delete(ctx, book.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.PollUntilContextTimeout(ctx, time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return c.workqueue.Len() == 1, nil
+	}); err != nil {
+		t.Fatalf("deleted Book was not queued: %v", err)
+	}
+	if !c.processNextWorkItem(ctx) {
+		t.Fatal("queue shut down")
+	}
+
+	if n := testutil.CollectAndCount(metrics.BookAvailableReplicas); n != 0 {
+		t.Errorf("%d book_available_replicas series left after the delete, want 0", n)
+	}
+	if _, ok := c.envoyReportFor(objectRef); ok {
+		t.Error("Envoy report of the deleted Book was kept")
+	}
+}
+
+func TestReconcilePanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broken, healthy := tlsBook(), tlsBook()
+	broken.Name, broken.Spec.DeploymentName = "book-broken", "book-broken"
+	broken.Spec.Envoy, healthy.Spec.Envoy = nil, nil
+	c, _ := newInformerController(t, ctx, broken, healthy)
+	recorder := record.NewFakeRecorder(100)
+	c.recorder = recorder
+	c.kubeclientset.(*fake.Clientset).PrependReactor("create", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.CreateAction).GetObject().(*appsv1.Deployment).Name == broken.Spec.DeploymentName {
+			panic("broken Book")
+		}
+		return false, nil, nil
+	})
+
+	// Start over from the broken Book, followed by the healthy one.
+	for c.workqueue.Len() > 0 {
+		item, _ := c.workqueue.Get()
+		c.workqueue.Done(item)
+		c.workqueue.Forget(item)
+	}
+	brokenRef, healthyRef := cache.MetaObjectToName(broken), cache.MetaObjectToName(healthy)
+	c.workqueue.Add(brokenRef, priorityqueue.Normal)
+	c.workqueue.Add(healthyRef, priorityqueue.Normal)
+
+	if !c.processNextWorkItem(ctx) {
+		t.Fatal("queue shut down")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ReasonReconcilePanic) {
+			t.Errorf("event %q, want a %s event", event, ReasonReconcilePanic)
+		}
+	default:
+		t.Errorf("no event recorded for the panic, want a %s event", ReasonReconcilePanic)
+	}
+	if n := c.workqueue.NumRequeues(brokenRef); n != 0 {
+		t.Errorf("broken Book requeued %d times, want 0", n)
+	}
+
+	// The worker moves on to the next Book.
+	if !c.processNextWorkItem(ctx) {
+		t.Fatal("queue shut down")
+	}
+	if _, err := c.kubeclientset.AppsV1().Deployments(healthy.Namespace).Get(ctx, healthy.Spec.DeploymentName, metav1.GetOptions{}); err != nil {
+		t.Errorf("healthy Book not synced after the panic: %v", err)
+	}
+	if n := c.workqueue.Len(); n != 0 {
+		t.Errorf("%d items left in the queue, want 0", n)
+	}
+}
+
+func TestSyncHandlerInvalidSpec(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*bookv1.Book)
+	}{
+		{
+			name: "no deployment name",
+			mutate: func(book *bookv1.Book) {
+				book.Spec.DeploymentName = ""
+			},
+		},
+		{
+			name: "no container port",
+			mutate: func(book *bookv1.Book) {
+				book.Spec.Container.Ports = nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := tlsBook()
+			tt.mutate(book)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(book); err != nil {
+				t.Fatal(err)
+			}
+			c := &Controller{bookLister: mergedBookLister{metav1.NamespaceAll: listers.NewBookLister(indexer)}}
+
+			err := c.syncHandler(context.Background(), cache.MetaObjectToName(book))
+			if classify(err) != classTerminal || terminalReason(err) != ReasonInvalidSpec {
+				t.Errorf("syncHandler() = %v, want a terminal %s error", err, ReasonInvalidSpec)
+			}
+		})
+	}
+}
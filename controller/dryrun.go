@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// diffOptions ignore the fields the API server manages, and those stripped
+// from the cached objects.
+var diffOptions = []cmp.Option{
+	cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ManagedFields", "ResourceVersion", "Generation"),
+	cmpopts.EquateEmpty(),
+	cmp.Comparer(func(a, b resource.Quantity) bool { return a.Cmp(b) == 0 }),
+}
+
+// dryRunReport collects the changes the controller would have made in
+// dry-run mode.
+type dryRunReport struct {
+	mu sync.Mutex
+	// changes maps "<kind> <namespace>/<name>" to the last operation that
+	// would have been issued on the object.
+	changes map[string]string
+}
+
+func newDryRunReport() *dryRunReport {
+	return &dryRunReport{changes: map[string]string{}}
+}
+
+// createOptions returns the options of the create calls of the sync loop.
+func (c *Controller) createOptions() metav1.CreateOptions {
+	opts := metav1.CreateOptions{FieldManager: FieldManager}
+	if c.dryRun != nil {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+// updateOptions returns the options of the update calls of the sync loop.
+func (c *Controller) updateOptions() metav1.UpdateOptions {
+	opts := metav1.UpdateOptions{FieldManager: FieldManager}
+	if c.dryRun != nil {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+// deleteOptions returns the options of the delete calls of the sync loop.
+func (c *Controller) deleteOptions() metav1.DeleteOptions {
+	opts := metav1.DeleteOptions{}
+	if c.dryRun != nil {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+// recordChange logs in dry-run mode how a write would have changed an
+// object. current is nil for a create. result is the object returned by the
+// dry-run call, that is the object as the API server would have stored it.
+// Updates that would not change anything are not reported.
+func (c *Controller) recordChange(ctx context.Context, kind, operation string, current, result runtime.Object) {
+	if c.dryRun == nil || result == nil {
+		return
+	}
+	object, err := meta.Accessor(result)
+	if err != nil {
+		return
+	}
+	logger := klog.FromContext(ctx).WithValues("kind", kind, "object", klog.KObj(object))
+
+	switch operation {
+	case metrics.OperationCreate:
+		logger.Info("Dry run: would create")
+	default:
+		diff := cmp.Diff(current, result, diffOptions...)
+		if diff == "" {
+			return
+		}
+		logger.Info("Dry run: would "+operation, "diff", diff)
+	}
+
+	c.dryRun.mu.Lock()
+	defer c.dryRun.mu.Unlock()
+	c.dryRun.changes[fmt.Sprintf("%s %s/%s", kind, object.GetNamespace(), object.GetName())] = operation
+}
+
+// logSummary logs every object the dry run would have changed.
+func (r *dryRunReport) logSummary(logger klog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := map[string]int{}
+	changes := make([]string, 0, len(r.changes))
+	for object, operation := range r.changes {
+		counts[operation]++
+		changes = append(changes, operation+" "+object)
+	}
+	sort.Strings(changes)
+	logger.Info("Dry run summary", "objects", len(changes), "creates", counts[metrics.OperationCreate],
+		"updates", counts[metrics.OperationUpdate], "deletes", counts[metrics.OperationDelete], "changes", changes)
+}
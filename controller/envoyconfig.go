@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoy"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EnvoyConfigHashAnnotation is set on the pod template of the envoy
+	// Deployment to the hash of its configuration, so that envoy is rolled
+	// out when the configuration changes.
+	EnvoyConfigHashAnnotation = "simplecustomcontroller.crd.com/envoy-config-hash"
+
+	// envoyListenPort is the port envoy serves the book API on.
+	envoyListenPort = 1999
+)
+
+// envoyConfig returns the envoy configuration of book: the file of the
+// EnvoyConfiguration when one is set, the configuration rendered from the
+// Book spec and mirror otherwise.
+func envoyConfig(book *bookv1.Book, defaults configv1alpha1.EnvoyConfiguration, mirror *envoy.Mirror) (string, error) {
+	if defaults.ConfigFile != "" {
+		data, err := os.ReadFile(defaults.ConfigFile)
+		if err != nil {
+			return "", fmt.Errorf("reading envoy config: %w", err)
+		}
+		return string(data), nil
+	}
+	data, err := envoy.Render(envoy.Config{
+		Name:             book.Name,
+		Namespace:        book.Namespace,
+		ListenPort:       envoyListenPort,
+		AdminPort:        envoyAdminPort,
+		UpstreamHost:     upstreamHost(book),
+		FallbackHost:     fallbackHost(book),
+		UpstreamPort:     book.Spec.Container.Ports[0].ContainerPort,
+		UpstreamProtocol: servedProtocol(book),
+		UpstreamTLS:      mutualTLS(book),
+		Spec:             book.Spec.Envoy,
+		Mirror:           mirror,
+		WakeUpTimeout:    wakeUpTimeout(book),
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering envoy config: %w", err)
+	}
+	return string(data), nil
+}
+
+// configHash returns a short hash of the data of a ConfigMap.
+func configHash(data map[string]string) string {
+	h := sha256.New()
+	for _, key := range sets.List(sets.KeySet(data)) {
+		fmt.Fprintf(h, "%s\x00%s\x00", key, data[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// readinessProbe returns the readinessProbe of the book-server container:
+// the one of the Book spec, or else a probe of the health check path of the
+// envoy upstream. The fields the API server would default are set so that
+// the probe compares equal to the one stored.
+func readinessProbe(book *bookv1.Book) *corev1.Probe {
+	if book.Spec.Container.ReadinessProbe != nil {
+		return book.Spec.Container.ReadinessProbe
+	}
+	if book.Spec.Envoy == nil || book.Spec.Envoy.Upstream == nil || book.Spec.Envoy.Upstream.HealthCheck == nil {
+		return nil
+	}
+	check := book.Spec.Envoy.Upstream.HealthCheck
+	// The kubelet presents no client certificate: with mutual TLS, the
+	// book-server has to let the probe through without one.
+	scheme := corev1.URISchemeHTTP
+	if mutualTLS(book) {
+		scheme = corev1.URISchemeHTTPS
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   check.Path,
+				Port:   intstr.FromInt32(book.Spec.Container.Ports[0].ContainerPort),
+				Scheme: scheme,
+			},
+		},
+		TimeoutSeconds:   1,
+		PeriodSeconds:    max(int32(envoy.HealthCheckInterval(check).Seconds()), 1),
+		SuccessThreshold: 1,
+		FailureThreshold: 3,
+	}
+}
+
+// jwtSpec returns the JWT settings of book, or nil.
+func jwtSpec(book *bookv1.Book) *bookv1.JWTSpec {
+	if book.Spec.Envoy == nil || book.Spec.Envoy.Auth == nil {
+		return nil
+	}
+	return book.Spec.Envoy.Auth.JWT
+}
+
+// jwksIndex indexes the Books by the ConfigMaps and Secrets holding the key
+// sets of their JWT providers.
+const jwksIndex = "jwks"
+
+// jwksPollInterval is how often pollJWKS reads the ConfigMaps and Secrets
+// the Books refer to. They are not watched, which would take a list/watch
+// of every Secret of the watched namespaces.
+const jwksPollInterval = time.Minute
+
+// jwksIndexKey returns the jwksIndex key of the ConfigMap or Secret, of the
+// given kind, namespace and name.
+func jwksIndexKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// jwksIndexFunc returns the jwksIndex keys of a Book.
+func jwksIndexFunc(obj interface{}) ([]string, error) {
+	book, ok := obj.(*bookv1.Book)
+	if !ok {
+		return nil, nil
+	}
+	spec := jwtSpec(book)
+	if spec == nil {
+		return nil, nil
+	}
+	var keys []string
+	for _, provider := range spec.Providers {
+		switch source := provider.JWKS; {
+		case source.ConfigMapKeyRef != nil:
+			keys = append(keys, jwksIndexKey("ConfigMap", book.Namespace, source.ConfigMapKeyRef.Name))
+		case source.SecretKeyRef != nil:
+			keys = append(keys, jwksIndexKey("Secret", book.Namespace, source.SecretKeyRef.Name))
+		}
+	}
+	return keys, nil
+}
+
+// jwksObject returns the values of the ConfigMap or Secret of the given
+// kind, namespace and name, by key.
+func (c *Controller) jwksObject(ctx context.Context, kind, namespace, name string) (map[string][]byte, error) {
+	values := map[string][]byte{}
+	switch kind {
+	case "ConfigMap":
+		configMap, err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range configMap.BinaryData {
+			values[key] = value
+		}
+		for key, value := range configMap.Data {
+			values[key] = []byte(value)
+		}
+	case "Secret":
+		secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range secret.Data {
+			values[key] = value
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s", kind)
+	}
+	return values, nil
+}
+
+// runJWKSPoller runs pollJWKS every jwksPollInterval until ctx is done.
+func (c *Controller) runJWKSPoller(ctx context.Context) {
+	wait.UntilWithContext(ctx, c.pollJWKS, jwksPollInterval)
+}
+
+// pollJWKS reads the ConfigMaps and Secrets listed in jwksIndex and queues
+// the Books referring to one whose values changed since the previous poll,
+// or that was created or deleted since. Only the objects referred to by a
+// Book of this shard are read, and only a hash of their values is kept.
+func (c *Controller) pollJWKS(ctx context.Context) {
+	if c.jwksHashes == nil {
+		c.jwksHashes = map[string]string{}
+	}
+	referenced := sets.New[string]()
+	for _, indexer := range c.bookIndexers {
+		referenced.Insert(indexer.ListIndexFuncValues(jwksIndex)...)
+	}
+	for key := range c.jwksHashes {
+		if !referenced.Has(key) {
+			delete(c.jwksHashes, key)
+		}
+	}
+	for _, key := range sets.List(referenced) {
+		books, err := c.bookIndexers.byIndex(jwksIndex, key)
+		if err != nil {
+			utilruntime.HandleErrorWithContext(ctx, err, "Error listing the books referring to a key set", "key", key)
+			continue
+		}
+		if c.sharder != nil {
+			books = slices.DeleteFunc(books, func(book *bookv1.Book) bool {
+				return !c.sharder.Owns(cache.MetaObjectToName(book))
+			})
+		}
+		if len(books) == 0 {
+			continue
+		}
+
+		kind, name, _ := strings.Cut(key, "/")
+		namespace, name, _ := strings.Cut(name, "/")
+		values, err := c.jwksObject(ctx, kind, namespace, name)
+		if err != nil && !errors.IsNotFound(err) {
+			utilruntime.HandleErrorWithContext(ctx, err, "Error reading key set", "kind", kind, "object", klog.KRef(namespace, name))
+			continue
+		}
+		// A missing object hashes to the empty string.
+		var hash string
+		if err == nil {
+			hashed := map[string]string{}
+			for key, value := range values {
+				hashed[key] = string(value)
+			}
+			hash = configHash(hashed)
+		}
+		previous, seen := c.jwksHashes[key]
+		c.jwksHashes[key] = hash
+		if !seen || previous == hash {
+			continue
+		}
+		klog.FromContext(ctx).V(4).Info("Key set changed", "kind", kind, "object", klog.KRef(namespace, name), "books", len(books))
+		for _, book := range books {
+			c.enqueueBook(book, priorityqueue.Normal)
+		}
+	}
+}
+
+// jwksData reads the key sets the JWT providers of book refer to, by
+// provider. Envoy only reads them on start, so they are part of the hash of
+// its configuration. A missing key set is a terminal error, unless it is
+// optional: envoy would not start without it.
+func (c *Controller) jwksData(ctx context.Context, book *bookv1.Book) (map[string]string, error) {
+	spec := jwtSpec(book)
+	if spec == nil {
+		return nil, nil
+	}
+	data := map[string]string{}
+	for _, provider := range spec.Providers {
+		var kind, name, key string
+		var optional bool
+		switch source := provider.JWKS; {
+		case source.ConfigMapKeyRef != nil:
+			ref := source.ConfigMapKeyRef
+			kind, name, key, optional = "ConfigMap", ref.Name, ref.Key, ref.Optional != nil && *ref.Optional
+		case source.SecretKeyRef != nil:
+			ref := source.SecretKeyRef
+			kind, name, key, optional = "Secret", ref.Name, ref.Key, ref.Optional != nil && *ref.Optional
+		default:
+			continue
+		}
+		values, err := c.jwksObject(ctx, kind, book.Namespace, name)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("reading the key set of JWT provider %s: %w", provider.Name, err)
+		}
+		if value, found := values[key]; found {
+			data[provider.Name] = string(value)
+		} else if !optional {
+			return nil, terminalf(ReasonJWKSNotFound, "key %s of %s %s holding the key set of JWT provider %s does not exist", key, kind, name, provider.Name)
+		}
+	}
+	return data, nil
+}
+
+// jwksVolumes returns the volumes and mounts of the key sets of the JWT
+// providers of book that live in a ConfigMap or a Secret.
+func jwksVolumes(book *bookv1.Book) ([]corev1.Volume, []corev1.VolumeMount) {
+	spec := jwtSpec(book)
+	if spec == nil {
+		return nil, nil
+	}
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, provider := range spec.Providers {
+		volume := corev1.Volume{Name: "jwks-" + provider.Name}
+		switch source := provider.JWKS; {
+		case source.ConfigMapKeyRef != nil:
+			volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: source.ConfigMapKeyRef.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: source.ConfigMapKeyRef.Key, Path: envoy.JWKSFileName}},
+				Optional:             source.ConfigMapKeyRef.Optional,
+			}
+		case source.SecretKeyRef != nil:
+			volume.Secret = &corev1.SecretVolumeSource{
+				SecretName: source.SecretKeyRef.Name,
+				Items:      []corev1.KeyToPath{{Key: source.SecretKeyRef.Key, Path: envoy.JWKSFileName}},
+				Optional:   source.SecretKeyRef.Optional,
+			}
+		default:
+			continue
+		}
+		volumes = append(volumes, volume)
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: path.Dir(envoy.JWKSFile(provider.Name)),
+			ReadOnly:  true,
+		})
+	}
+	return volumes, mounts
+}
+
+// servedProtocol returns the protocol of the port of the book-server that
+// envoy and the Service forward to.
+func servedProtocol(book *bookv1.Book) bookv1.AppProtocol {
+	for _, port := range book.Spec.PortProtocols {
+		if port.Port == book.Spec.Container.Ports[0].ContainerPort {
+			return port.Protocol
+		}
+	}
+	return bookv1.ProtocolHTTP
+}
+
+// serviceAppProtocol returns the appProtocol of the Service port speaking
+// protocol, over TLS when tls is set, using the values Kubernetes
+// standardises where there is one.
+func serviceAppProtocol(protocol bookv1.AppProtocol, tls bool) string {
+	switch {
+	case protocol == bookv1.ProtocolGRPC:
+		return string(protocol)
+	case protocol == bookv1.ProtocolWebSocket && tls:
+		return "kubernetes.io/wss"
+	case protocol == bookv1.ProtocolWebSocket:
+		return "kubernetes.io/ws"
+	case tls:
+		return "https"
+	case protocol == bookv1.ProtocolHTTP2:
+		return "kubernetes.io/h2c"
+	default:
+		return string(protocol)
+	}
+}
+
+// upstreamHost is the name envoy reaches the book-server pods of book at,
+// the one of its headless Service.
+func upstreamHost(book *bookv1.Book) string {
+	return fmt.Sprintf("%s.%s.svc", headlessServiceName(book), book.Namespace)
+}
+
+// serviceHost is the name of the Service of the book-server of book.
+func serviceHost(book *bookv1.Book) string {
+	return fmt.Sprintf("%s.%s.svc", serviceName(book), book.Namespace)
+}
+
+// fallbackHost is where envoy sends the requests while no book-server pod is
+// left: the Service of book when it scales to zero, none otherwise.
+func fallbackHost(book *bookv1.Book) string {
+	if wakeUpTimeout(book) == 0 {
+		return ""
+	}
+	return serviceHost(book)
+}
@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoyadmin"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// envoyAdminPort is the port of the admin API of the envoy proxies.
+	envoyAdminPort = 8001
+	// envoyAdminTimeout bounds a query of the admin API.
+	envoyAdminTimeout = 5 * time.Second
+
+	// ReasonAllHostsHealthy means every upstream host of envoy is healthy.
+	ReasonAllHostsHealthy = "AllHostsHealthy"
+	// ReasonUnhealthyHosts means some upstream hosts of envoy are unhealthy
+	// or an upstream has no host at all.
+	ReasonUnhealthyHosts = "UnhealthyHosts"
+	// ReasonAdminUnreachable means no envoy admin API could be queried.
+	ReasonAdminUnreachable = "AdminUnreachable"
+)
+
+// envoySample is the last snapshot read from an envoy pod.
+type envoySample struct {
+	at       time.Time
+	snapshot *envoyadmin.Snapshot
+}
+
+// envoyReport is the health of the upstreams of the envoy proxies of a Book,
+// as copied to its status.
+type envoyReport struct {
+	status    *bookv1.EnvoyStatus
+	condition metav1.Condition
+}
+
+// envoyHealth holds the results of the envoy admin API scrapes.
+type envoyHealth struct {
+	mu sync.Mutex
+	// samples maps the envoy pods to their last snapshot, used to turn the
+	// request counters into rates.
+	samples map[types.UID]envoySample
+	// reports maps the Books to the health of their envoy upstreams.
+	reports map[cache.ObjectName]envoyReport
+}
+
+// runEnvoyScraper queries the admin API of the envoy proxies every
+// AdminScrapeInterval until ctx is cancelled.
+func (c *Controller) runEnvoyScraper(ctx context.Context) {
+	for {
+		c.scrapeEnvoys(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.envoyDefaults.Load().AdminScrapeInterval.Duration):
+		}
+	}
+}
+
+// scrapeEnvoys refreshes the envoy health of every Book of this replica. A
+// Book whose host counts or condition changed is queued so that its status
+// catches up; the rates alone only move the metrics and are copied to the
+// status on the next sync.
+func (c *Controller) scrapeEnvoys(ctx context.Context) {
+	books, err := c.bookLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+
+	seenPods := map[types.UID]bool{}
+	seenBooks := map[cache.ObjectName]bool{}
+	for _, book := range books {
+		objectRef := cache.MetaObjectToName(book)
+		if c.sharder != nil && !c.sharder.Owns(objectRef) {
+			continue
+		}
+		seenBooks[objectRef] = true
+		running, scrapes, err := c.scrapeEnvoyPods(ctx, book)
+		if err != nil {
+			klog.FromContext(ctx).V(4).Info("Failed to list envoy pods", "book", klog.KObj(book), "err", err)
+			continue
+		}
+		for _, pod := range running {
+			seenPods[pod.UID] = true
+		}
+		if c.setEnvoyReport(objectRef, c.envoyReportOf(scrapes, len(running))) {
+			c.workqueue.Add(objectRef, priorityqueue.Low)
+		}
+		c.observeRequests(book, scrapes)
+	}
+
+	c.envoyHealth.mu.Lock()
+	defer c.envoyHealth.mu.Unlock()
+	for uid := range c.envoyHealth.samples {
+		if !seenPods[uid] {
+			delete(c.envoyHealth.samples, uid)
+		}
+	}
+	for objectRef := range c.envoyHealth.reports {
+		if !seenBooks[objectRef] {
+			c.forgetEnvoyReportLocked(objectRef)
+		}
+	}
+	c.forgetIdleExcept(seenBooks)
+}
+
+// envoyScrape is the answer of the admin API of an envoy pod.
+type envoyScrape struct {
+	pod      *corev1.Pod
+	snapshot *envoyadmin.Snapshot
+	at       time.Time
+}
+
+// scrapeEnvoyPods queries the running envoy pods of book concurrently. It
+// returns the running pods and the answers of those that could be queried.
+func (c *Controller) scrapeEnvoyPods(ctx context.Context, book *bookv1.Book) ([]*corev1.Pod, []envoyScrape, error) {
+	pods, err := c.podLister.Pods(book.Namespace).List(labels.SelectorFromSet(labels.Set{
+		"app":        "envoy",
+		"controller": book.Name,
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var running []*corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" && ownedByBook(pod, book) {
+			running = append(running, pod)
+		}
+	}
+
+	results := make([]envoyScrape, len(running))
+	var wg sync.WaitGroup
+	for i, pod := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			baseURL := "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(envoyAdminPort))
+			snapshot, err := c.envoyAdmin.Scrape(ctx, baseURL)
+			if err != nil {
+				metrics.EnvoyAdminScrapeErrors.Inc()
+				klog.FromContext(ctx).V(4).Info("Failed to query the envoy admin API", "pod", klog.KObj(pod), "err", err)
+				return
+			}
+			results[i] = envoyScrape{pod: pod, snapshot: snapshot, at: time.Now()}
+		}()
+	}
+	wg.Wait()
+
+	var scrapes []envoyScrape
+	for _, r := range results {
+		if r.snapshot != nil {
+			scrapes = append(scrapes, r)
+		}
+	}
+	return running, scrapes, nil
+}
+
+// envoyReportOf merges the answers of the envoy pods of a Book, of which
+// running are running.
+func (c *Controller) envoyReportOf(scrapes []envoyScrape, running int) envoyReport {
+	status := &bookv1.EnvoyStatus{}
+	upstreams := map[string]*bookv1.UpstreamStatus{}
+	requestRates := map[string]float64{}
+	errorRates := map[string]float64{}
+	rated := map[string]bool{}
+	var rateLimitedRate float64
+	rateLimitedRated := false
+
+	c.envoyHealth.mu.Lock()
+	for _, r := range scrapes {
+		status.ScrapedPods++
+		previous, hasPrevious := c.envoyHealth.samples[r.pod.UID]
+		c.envoyHealth.samples[r.pod.UID] = envoySample{at: r.at, snapshot: r.snapshot}
+
+		status.RateLimitedRequests += int64(r.snapshot.RateLimited)
+		if hasPrevious && r.at.After(previous.at) && r.snapshot.RateLimited >= previous.snapshot.RateLimited {
+			rateLimitedRate += float64(r.snapshot.RateLimited-previous.snapshot.RateLimited) / r.at.Sub(previous.at).Seconds()
+			rateLimitedRated = true
+		}
+
+		for name, cluster := range r.snapshot.Clusters {
+			upstream, ok := upstreams[name]
+			if !ok {
+				upstream = &bookv1.UpstreamStatus{Name: name, HealthyHosts: cluster.HealthyHosts, TotalHosts: cluster.TotalHosts}
+				upstreams[name] = upstream
+			}
+			upstream.HealthyHosts = min(upstream.HealthyHosts, cluster.HealthyHosts)
+			upstream.TotalHosts = max(upstream.TotalHosts, cluster.TotalHosts)
+
+			if !hasPrevious {
+				continue
+			}
+			before, ok := previous.snapshot.Clusters[name]
+			elapsed := r.at.Sub(previous.at).Seconds()
+			// A counter going down means envoy restarted.
+			if !ok || elapsed <= 0 || cluster.Requests < before.Requests || cluster.Errors5xx < before.Errors5xx {
+				continue
+			}
+			requestRates[name] += float64(cluster.Requests-before.Requests) / elapsed
+			errorRates[name] += float64(cluster.Errors5xx-before.Errors5xx) / elapsed
+			rated[name] = true
+		}
+	}
+	c.envoyHealth.mu.Unlock()
+
+	for name, upstream := range upstreams {
+		if rated[name] {
+			upstream.RequestRate = strconv.FormatFloat(requestRates[name], 'f', 2, 64)
+			upstream.ErrorRate = strconv.FormatFloat(errorRates[name], 'f', 2, 64)
+		}
+		status.Upstreams = append(status.Upstreams, *upstream)
+	}
+	if rateLimitedRated {
+		status.RateLimitedRate = strconv.FormatFloat(rateLimitedRate, 'f', 2, 64)
+	}
+	sort.Slice(status.Upstreams, func(i, j int) bool {
+		return status.Upstreams[i].Name < status.Upstreams[j].Name
+	})
+
+	return envoyReport{status: status, condition: envoyCondition(status, running)}
+}
+
+// envoyCondition derives the EnvoyUpstreamHealthy condition from status.
+func envoyCondition(status *bookv1.EnvoyStatus, running int) metav1.Condition {
+	condition := metav1.Condition{Type: bookv1.ConditionEnvoyUpstreamHealthy}
+	if status.ScrapedPods == 0 {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = ReasonAdminUnreachable
+		condition.Message = fmt.Sprintf("none of the %d running envoy pods answered on the admin port", running)
+		if running == 0 {
+			condition.Message = "no envoy pod is running"
+		}
+		return condition
+	}
+
+	var unhealthy []string
+	for _, upstream := range status.Upstreams {
+		if upstream.TotalHosts == 0 || upstream.HealthyHosts < upstream.TotalHosts {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %d/%d hosts healthy", upstream.Name, upstream.HealthyHosts, upstream.TotalHosts))
+		}
+	}
+	if len(unhealthy) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonUnhealthyHosts
+		condition.Message = strings.Join(unhealthy, "; ")
+		return condition
+	}
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = ReasonAllHostsHealthy
+	condition.Message = fmt.Sprintf("every host of the %d upstreams is healthy", len(status.Upstreams))
+	return condition
+}
+
+// setEnvoyReport stores the report of a Book and updates its metrics. It
+// reports whether the host counts or the condition changed.
+func (c *Controller) setEnvoyReport(objectRef cache.ObjectName, report envoyReport) bool {
+	c.envoyHealth.mu.Lock()
+	defer c.envoyHealth.mu.Unlock()
+	previous, ok := c.envoyHealth.reports[objectRef]
+	c.envoyHealth.reports[objectRef] = report
+
+	bookLabels := prometheus.Labels{"namespace": objectRef.Namespace, "name": objectRef.Name}
+	deleteEnvoyMetrics(bookLabels)
+	for _, upstream := range report.status.Upstreams {
+		values := []string{objectRef.Namespace, objectRef.Name, upstream.Name}
+		metrics.EnvoyUpstreamHealthyHosts.WithLabelValues(values...).Set(float64(upstream.HealthyHosts))
+		metrics.EnvoyUpstreamHosts.WithLabelValues(values...).Set(float64(upstream.TotalHosts))
+		if upstream.RequestRate != "" {
+			requestRate, _ := strconv.ParseFloat(upstream.RequestRate, 64)
+			errorRate, _ := strconv.ParseFloat(upstream.ErrorRate, 64)
+			metrics.EnvoyUpstreamRequestRate.WithLabelValues(values...).Set(requestRate)
+			metrics.EnvoyUpstreamErrorRate.WithLabelValues(values...).Set(errorRate)
+		}
+	}
+
+	if report.status.RateLimitedRate != "" {
+		rateLimitedRate, _ := strconv.ParseFloat(report.status.RateLimitedRate, 64)
+		metrics.EnvoyRateLimitedRate.WithLabelValues(objectRef.Namespace, objectRef.Name).Set(rateLimitedRate)
+	}
+
+	if !ok {
+		return true
+	}
+	return previous.status.ScrapedPods != report.status.ScrapedPods ||
+		previous.condition.Status != report.condition.Status ||
+		previous.condition.Message != report.condition.Message ||
+		!equality.Semantic.DeepEqual(hostCounts(previous.status), hostCounts(report.status))
+}
+
+// envoyReportFor returns the last report of a Book, if any.
+func (c *Controller) envoyReportFor(objectRef cache.ObjectName) (envoyReport, bool) {
+	c.envoyHealth.mu.Lock()
+	defer c.envoyHealth.mu.Unlock()
+	report, ok := c.envoyHealth.reports[objectRef]
+	return report, ok
+}
+
+// forgetEnvoyReport drops the report and the metrics of a deleted Book.
+func (c *Controller) forgetEnvoyReport(objectRef cache.ObjectName) {
+	c.envoyHealth.mu.Lock()
+	defer c.envoyHealth.mu.Unlock()
+	c.forgetEnvoyReportLocked(objectRef)
+}
+
+func (c *Controller) forgetEnvoyReportLocked(objectRef cache.ObjectName) {
+	delete(c.envoyHealth.reports, objectRef)
+	deleteEnvoyMetrics(prometheus.Labels{"namespace": objectRef.Namespace, "name": objectRef.Name})
+}
+
+func deleteEnvoyMetrics(bookLabels prometheus.Labels) {
+	metrics.EnvoyUpstreamHealthyHosts.DeletePartialMatch(bookLabels)
+	metrics.EnvoyUpstreamHosts.DeletePartialMatch(bookLabels)
+	metrics.EnvoyUpstreamRequestRate.DeletePartialMatch(bookLabels)
+	metrics.EnvoyUpstreamErrorRate.DeletePartialMatch(bookLabels)
+	metrics.EnvoyRateLimitedRate.DeletePartialMatch(bookLabels)
+}
+
+// hostCounts returns the upstreams of status without their rates.
+func hostCounts(status *bookv1.EnvoyStatus) []bookv1.UpstreamStatus {
+	counts := make([]bookv1.UpstreamStatus, 0, len(status.Upstreams))
+	for _, upstream := range status.Upstreams {
+		counts = append(counts, bookv1.UpstreamStatus{Name: upstream.Name, HealthyHosts: upstream.HealthyHosts, TotalHosts: upstream.TotalHosts})
+	}
+	return counts
+}
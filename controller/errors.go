@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// ReasonInvalidSpec is the Degraded reason of a Book whose spec cannot
+	// be synced.
+	ReasonInvalidSpec = "InvalidSpec"
+	// ReasonInvalidObject is the Degraded reason of a Book whose owned
+	// objects are rejected by the API server.
+	ReasonInvalidObject = "InvalidObject"
+	// ReasonReconcilePanic is the Degraded reason, and the Event reason, of
+	// a Book whose sync panicked.
+	ReasonReconcilePanic = "ReconcilePanic"
+	// ReasonJWKSNotFound is the Degraded reason of a Book whose JWT key set
+	// is missing from the ConfigMap or Secret it refers to. The Book is
+	// synced again when the ConfigMap or Secret changes.
+	ReasonJWKSNotFound = "JWKSNotFound"
+	// ReasonRetriesExhausted is the Degraded reason of a Book that kept
+	// failing with transient errors until the retries ran out.
+	ReasonRetriesExhausted = "RetriesExhausted"
+)
+
+// errorClass tells processNextWorkItem how to retry a failed sync.
+type errorClass int
+
+const (
+	// classTransient errors are retried with a backoff.
+	classTransient errorClass = iota
+	// classConflict errors come from writes based on a stale object. They
+	// are retried after the base delay of the backoff.
+	classConflict
+	// classTerminal errors are not retried until the generation of the Book
+	// changes.
+	classTerminal
+)
+
+// TerminalError is a sync error that retrying does not fix, like a child
+// object owned by someone else or a spec the API server rejects. The Book
+// is marked Degraded with Reason and left alone until its spec changes.
+type TerminalError struct {
+	Reason string
+	Err    error
+}
+
+func (e *TerminalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TerminalError) Unwrap() error {
+	return e.Err
+}
+
+// terminalf returns a TerminalError with the given reason and message.
+func terminalf(reason, format string, args ...interface{}) error {
+	return &TerminalError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// classify returns how err should be retried.
+func classify(err error) errorClass {
+	var terminalErr *TerminalError
+	switch {
+	case errors.As(err, &terminalErr):
+		return classTerminal
+	case apierrors.IsConflict(err):
+		return classConflict
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return classTerminal
+	default:
+		return classTransient
+	}
+}
+
+// terminalReason returns the Degraded reason of a terminal error.
+func terminalReason(err error) string {
+	var terminalErr *TerminalError
+	if errors.As(err, &terminalErr) {
+		return terminalErr.Reason
+	}
+	return ReasonInvalidObject
+}
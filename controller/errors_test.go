@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestClassify(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	conflict := apierrors.NewConflict(deployments, "book-api", errors.New("the object has been modified"))
+	invalid := apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "book-api",
+		field.ErrorList{field.Invalid(field.NewPath("spec", "replicas"), -1, "must be greater than or equal to 0")})
+
+	tests := []struct {
+		name       string
+		err        error
+		want       errorClass
+		wantReason string
+	}{
+		{
+			name:       "terminal",
+			err:        terminalf(ReasonInvalidSpec, "no container port"),
+			want:       classTerminal,
+			wantReason: ReasonInvalidSpec,
+		},
+		{
+			name:       "wrapped terminal",
+			err:        fmt.Errorf("syncing envoy: %w", terminalf(ReasonJWKSNotFound, "key set missing")),
+			want:       classTerminal,
+			wantReason: ReasonJWKSNotFound,
+		},
+		{
+			name:       "terminal wrapping a conflict",
+			err:        &TerminalError{Reason: ReasonInvalidObject, Err: conflict},
+			want:       classTerminal,
+			wantReason: ReasonInvalidObject,
+		},
+		{
+			name: "conflict",
+			err:  conflict,
+			want: classConflict,
+		},
+		{
+			name: "wrapped conflict",
+			err:  fmt.Errorf("updating deployment: %w", conflict),
+			want: classConflict,
+		},
+		{
+			name:       "invalid",
+			err:        invalid,
+			want:       classTerminal,
+			wantReason: ReasonInvalidObject,
+		},
+		{
+			name:       "bad request",
+			err:        apierrors.NewBadRequest("json: cannot unmarshal string"),
+			want:       classTerminal,
+			wantReason: ReasonInvalidObject,
+		},
+		{
+			name: "too many requests",
+			err:  apierrors.NewTooManyRequests("slow down", 1),
+			want: classTransient,
+		},
+		{
+			name: "server timeout",
+			err:  apierrors.NewServerTimeout(deployments, "update", 1),
+			want: classTransient,
+		},
+		{
+			name: "forbidden",
+			err:  apierrors.NewForbidden(deployments, "book-api", errors.New("RBAC")),
+			want: classTransient,
+		},
+		{
+			name: "deadline exceeded",
+			err:  fmt.Errorf("updating status: %w", context.DeadlineExceeded),
+			want: classTransient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			if got != tt.want {
+				t.Errorf("classify() = %d, want %d", got, tt.want)
+			}
+			if got == classTerminal {
+				if reason := terminalReason(tt.err); reason != tt.wantReason {
+					t.Errorf("terminalReason() = %s, want %s", reason, tt.wantReason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoy"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ReasonNoRecentRequests means the book-server is scaled down because
+	// envoy received no request for spec.idle.timeout.
+	ReasonNoRecentRequests = "NoRecentRequests"
+	// ReasonServingRequests means the book-server runs, either because it
+	// receives requests or because a request woke it up.
+	ReasonServingRequests = "ServingRequests"
+
+	// idleWakeInterval is how often the envoy pods of the idle Books are
+	// queried for requests waiting for the book-server.
+	idleWakeInterval = 2 * time.Second
+	// defaultWakeUpTimeout is how long envoy holds a request while the
+	// book-server scales up, when spec.idle.wakeUpTimeout is not set.
+	defaultWakeUpTimeout = time.Minute
+)
+
+// requestCounters are the counters of an envoy pod that tell whether the
+// book-server is used.
+type requestCounters struct {
+	// requests received by envoy.
+	requests uint64
+	// pending requests, which waited for a connection to the book-server.
+	pending uint64
+}
+
+// idleState is what the controller knows of the activity of a Book.
+type idleState struct {
+	idle         bool
+	lastActivity time.Time
+	// counters maps the envoy pods to their counters at the last check.
+	counters map[types.UID]requestCounters
+}
+
+// idleTracker holds the activity of the Books with spec.idle.
+type idleTracker struct {
+	mu    sync.Mutex
+	books map[cache.ObjectName]*idleState
+}
+
+// runIdleWaker watches the envoy pods of the idle Books more often than the
+// envoy scraper, so that a request wakes up the book-server quickly, until
+// ctx is cancelled.
+func (c *Controller) runIdleWaker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idleWakeInterval):
+		}
+		books, err := c.bookLister.List(labels.Everything())
+		if err != nil {
+			continue
+		}
+		for _, book := range books {
+			if !c.isIdle(book) || (c.sharder != nil && !c.sharder.Owns(cache.MetaObjectToName(book))) {
+				continue
+			}
+			if _, scrapes, err := c.scrapeEnvoyPods(ctx, book); err == nil {
+				c.observeRequests(book, scrapes)
+			}
+		}
+	}
+}
+
+// observeRequests updates the activity of book from the answers of its
+// envoy pods. A Book with no request for spec.idle.timeout becomes idle and
+// is queued to be scaled down. An idle Book wakes up, and is queued right
+// away, as soon as a request waits for its book-server.
+func (c *Controller) observeRequests(book *bookv1.Book, scrapes []envoyScrape) {
+	if book.Spec.Idle == nil {
+		return
+	}
+	objectRef := cache.MetaObjectToName(book)
+	now := c.clock.Now()
+
+	c.idle.mu.Lock()
+	state, ok := c.idle.books[objectRef]
+	if !ok {
+		// The activity before the controller started is unknown, the
+		// timeout starts over.
+		state = &idleState{
+			idle:         meta.IsStatusConditionTrue(book.Status.Conditions, bookv1.ConditionIdle),
+			lastActivity: now,
+		}
+		c.idle.books[objectRef] = state
+	}
+	active, waiting := false, false
+	counters := make(map[types.UID]requestCounters, len(scrapes))
+	for _, scrape := range scrapes {
+		current := requestCounters{requests: scrape.snapshot.DownstreamRequests}
+		if cluster, ok := scrape.snapshot.Clusters[envoy.UpstreamCluster]; ok {
+			current.pending = cluster.PendingRequests
+		}
+		counters[scrape.pod.UID] = current
+		// Pods seen for the first time, or restarted, give no evidence.
+		previous, ok := state.counters[scrape.pod.UID]
+		if !ok {
+			continue
+		}
+		active = active || current.requests > previous.requests
+		waiting = waiting || current.pending > previous.pending
+	}
+	state.counters = counters
+
+	changed := false
+	switch {
+	case state.idle && (waiting || active):
+		state.idle, state.lastActivity, changed = false, now, true
+	case active:
+		state.lastActivity = now
+	case !state.idle && len(scrapes) > 0 && now.Sub(state.lastActivity) >= book.Spec.Idle.Timeout.Duration:
+		// Without an answer from envoy the Book is not known to be idle.
+		state.idle, changed = true, true
+	}
+	idle := state.idle
+	c.idle.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if idle {
+		c.workqueue.Add(objectRef, priorityqueue.Normal)
+		return
+	}
+	// A request is waiting.
+	c.workqueue.Add(objectRef, priorityqueue.High)
+}
+
+// isIdle reports whether the book-server of book should be scaled down.
+func (c *Controller) isIdle(book *bookv1.Book) bool {
+	if book.Spec.Idle == nil {
+		return false
+	}
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	if state, ok := c.idle.books[cache.MetaObjectToName(book)]; ok {
+		return state.idle
+	}
+	// Not observed since the controller started: it stays as it was.
+	return meta.IsStatusConditionTrue(book.Status.Conditions, bookv1.ConditionIdle)
+}
+
+// forgetIdleExcept drops the activity of the Books not in books.
+func (c *Controller) forgetIdleExcept(books map[cache.ObjectName]bool) {
+	c.idle.mu.Lock()
+	defer c.idle.mu.Unlock()
+	for objectRef := range c.idle.books {
+		if !books[objectRef] {
+			delete(c.idle.books, objectRef)
+		}
+	}
+}
+
+// replicas returns the replicas of the book-server Deployment of book: none
+// while it is idle, and one when it wakes up without spec.replicas.
+func replicas(book *bookv1.Book, idle bool) *int32 {
+	if idle {
+		zero := int32(0)
+		return &zero
+	}
+	if book.Spec.Replicas == nil && meta.IsStatusConditionTrue(book.Status.Conditions, bookv1.ConditionIdle) {
+		one := int32(1)
+		return &one
+	}
+	return book.Spec.Replicas
+}
+
+// idleCondition returns the Idle condition of book, nil without spec.idle.
+func idleCondition(book *bookv1.Book, idle bool) *metav1.Condition {
+	if book.Spec.Idle == nil {
+		return nil
+	}
+	condition := &metav1.Condition{
+		Type:               bookv1.ConditionIdle,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonServingRequests,
+		Message:            "the book-server is running",
+		ObservedGeneration: book.Generation,
+	}
+	if idle {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ReasonNoRecentRequests
+		condition.Message = fmt.Sprintf("no request for %s, the book-server is scaled down to zero", book.Spec.Idle.Timeout.Duration)
+	}
+	return condition
+}
+
+// wakeUpTimeout returns how long envoy holds the requests of book while its
+// book-server scales up, zero without spec.idle.
+func wakeUpTimeout(book *bookv1.Book) time.Duration {
+	switch {
+	case book.Spec.Idle == nil:
+		return 0
+	case book.Spec.Idle.WakeUpTimeout != nil:
+		return book.Spec.Idle.WakeUpTimeout.Duration
+	default:
+		return defaultWakeUpTimeout
+	}
+}
@@ -0,0 +1,427 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "book-api"
+)
+
+// jwtBook returns a Book whose single JWT provider reads its key set from
+// the jwks.json key of the ConfigMap book-api-jwks.
+func jwtBook() *bookv1.Book {
+	return &bookv1.Book{
+		ObjectMeta: metav1.ObjectMeta{Name: "book-api", Namespace: "default", UID: "uid"},
+		Spec: bookv1.BookSpec{
+			DeploymentName: "book-api",
+			Container: corev1.Container{
+				Name:  "book-server",
+				Image: "book-server",
+				Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+			},
+			Envoy: &bookv1.EnvoySpec{
+				Auth: &bookv1.AuthSpec{
+					JWT: &bookv1.JWTSpec{
+						Providers: []bookv1.JWTProvider{{
+							Name:      "internal",
+							Issuer:    testIssuer,
+							Audiences: []string{testAudience},
+							JWKS: bookv1.JWKSSource{
+								ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "book-api-jwks"},
+									Key:                  "jwks.json",
+								},
+							},
+						}},
+						ExemptPathPrefixes: []string{"/healthz"},
+					},
+				},
+			},
+		},
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// newJWKS returns the key set publishing the public half of key.
+func newJWKS(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	data, err := json.Marshal(jwks{Keys: []jwk{{
+		Kty: "RSA",
+		Kid: "test",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// signJWT returns an RS256 token carrying claims, signed by key.
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// verifyJWT checks the RS256 signature of token against the keys of set,
+// the way envoy does with the mounted key set, and returns its claims.
+func verifyJWT(token, set string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	var keys jwks
+	if err := json.Unmarshal([]byte(set), &keys); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	for _, key := range keys.Keys {
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) != nil {
+			continue
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		var claims map[string]interface{}
+		return claims, json.Unmarshal(payload, &claims)
+	}
+	return nil, errors.New("no key of the set verifies the token")
+}
+
+// findKey returns the first value of key in the decoded YAML document doc.
+func findKey(doc interface{}, key string) (interface{}, bool) {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		if value, ok := doc[key]; ok {
+			return value, true
+		}
+		for _, value := range doc {
+			if found, ok := findKey(value, key); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for _, value := range doc {
+			if found, ok := findKey(value, key); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// mountedKeySet returns the key set envoy reads for the rendered JWT
+// provider: the inline one, or else the value of the ConfigMap or Secret
+// mounted at its local_jwks filename.
+func mountedKeySet(t *testing.T, c *Controller, book *bookv1.Book, provider map[string]interface{}) string {
+	t.Helper()
+	deployment := newEnvoyDeployment(book, configv1alpha1.EnvoyConfiguration{}, "hash")
+	if inline, ok := findKey(provider["local_jwks"], "inline_string"); ok {
+		if volumes, _ := jwksVolumes(book); len(volumes) != 0 {
+			t.Errorf("inline key set is also mounted from %v", volumes)
+		}
+		return inline.(string)
+	}
+	filename, ok := findKey(provider["local_jwks"], "filename")
+	if !ok {
+		t.Fatalf("local_jwks = %v, want a filename or an inline_string", provider["local_jwks"])
+	}
+	dir, file := path.Split(filename.(string))
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath != path.Clean(dir) {
+				continue
+			}
+			for _, volume := range deployment.Spec.Template.Spec.Volumes {
+				if volume.Name != mount.Name {
+					continue
+				}
+				ctx := context.Background()
+				switch {
+				case volume.ConfigMap != nil && len(volume.ConfigMap.Items) == 1 && volume.ConfigMap.Items[0].Path == file:
+					configMap, err := c.kubeclientset.CoreV1().ConfigMaps(book.Namespace).Get(ctx, volume.ConfigMap.Name, metav1.GetOptions{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					return configMap.Data[volume.ConfigMap.Items[0].Key]
+				case volume.Secret != nil && len(volume.Secret.Items) == 1 && volume.Secret.Items[0].Path == file:
+					secret, err := c.kubeclientset.CoreV1().Secrets(book.Namespace).Get(ctx, volume.Secret.SecretName, metav1.GetOptions{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					return string(secret.Data[volume.Secret.Items[0].Key])
+				}
+			}
+		}
+	}
+	t.Fatalf("nothing mounted at %s in the envoy pods", filename)
+	return ""
+}
+
+func TestJWTConfig(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := newJWKS(t, key)
+
+	for _, tc := range []struct {
+		name    string
+		source  bookv1.JWKSSource
+		objects []runtime.Object
+	}{
+		{
+			name: "ConfigMap",
+			source: bookv1.JWKSSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "book-api-jwks"},
+				Key:                  "jwks.json",
+			}},
+			objects: []runtime.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "book-api-jwks", Namespace: "default"},
+				Data:       map[string]string{"jwks.json": set, "other.json": `{"keys":[]}`},
+			}},
+		},
+		{
+			name: "Secret",
+			source: bookv1.JWKSSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "book-api-jwks"},
+				Key:                  "keys",
+			}},
+			objects: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "book-api-jwks", Namespace: "default"},
+				Data:       map[string][]byte{"keys": []byte(set)},
+			}},
+		},
+		{
+			name:   "inline",
+			source: bookv1.JWKSSource{Inline: set},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			book := jwtBook()
+			book.Spec.Envoy.Auth.JWT.Providers[0].JWKS = tc.source
+			c := &Controller{kubeclientset: fake.NewSimpleClientset(tc.objects...)}
+
+			configMap, err := newEnvoyConfigMap(book, configv1alpha1.EnvoyConfiguration{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc interface{}
+			if err := yaml.Unmarshal([]byte(configMap.Data["envoy.yaml"]), &doc); err != nil {
+				t.Fatalf("parsing rendered config: %v", err)
+			}
+			providers, ok := findKey(doc, "providers")
+			if !ok {
+				t.Fatal("rendered config has no jwt_authn providers")
+			}
+			provider, ok := providers.(map[string]interface{})["internal"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("provider internal missing from %v", providers)
+			}
+			if provider["issuer"] != testIssuer {
+				t.Errorf("issuer = %v, want %s", provider["issuer"], testIssuer)
+			}
+			if audiences, _ := provider["audiences"].([]interface{}); len(audiences) != 1 || audiences[0] != testAudience {
+				t.Errorf("audiences = %v, want [%s]", provider["audiences"], testAudience)
+			}
+
+			keySet := mountedKeySet(t, c, book, provider)
+			data, err := c.jwksData(context.Background(), book)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.source.Inline == "" && data["internal"] != keySet {
+				t.Errorf("jwksData = %q, want the mounted key set %q", data["internal"], keySet)
+			}
+
+			token := signJWT(t, key, map[string]interface{}{"iss": testIssuer, "aud": testAudience, "sub": "reader"})
+			claims, err := verifyJWT(token, keySet)
+			if err != nil {
+				t.Fatalf("verifying token against the key set envoy reads: %v", err)
+			}
+			if claims["iss"] != provider["issuer"] || claims["aud"] != testAudience {
+				t.Errorf("claims = %v, want those accepted by provider internal", claims)
+			}
+			if _, err := verifyJWT(signJWT(t, other, map[string]interface{}{"iss": testIssuer}), keySet); err == nil {
+				t.Error("token signed by another key verified")
+			}
+		})
+	}
+}
+
+func TestJWKSData(t *testing.T) {
+	ctx := context.Background()
+	book := jwtBook()
+	client := fake.NewSimpleClientset()
+	c := &Controller{kubeclientset: client}
+	configMaps := client.CoreV1().ConfigMaps("default")
+
+	_, err := c.jwksData(ctx, book)
+	if classify(err) != classTerminal || terminalReason(err) != ReasonJWKSNotFound {
+		t.Fatalf("missing ConfigMap: err = %v, want a terminal %s error", err, ReasonJWKSNotFound)
+	}
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "book-api-jwks", Namespace: "default"},
+		Data:       map[string]string{"other.json": "{}"},
+	}
+	if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.jwksData(ctx, book); classify(err) != classTerminal || terminalReason(err) != ReasonJWKSNotFound {
+		t.Errorf("missing key: err = %v, want a terminal %s error", err, ReasonJWKSNotFound)
+	}
+
+	optional := true
+	book.Spec.Envoy.Auth.JWT.Providers[0].JWKS.ConfigMapKeyRef.Optional = &optional
+	if data, err := c.jwksData(ctx, book); err != nil || len(data) != 0 {
+		t.Errorf("missing optional key: jwksData = %v, %v, want nothing", data, err)
+	}
+
+	configMap.Data["jwks.json"] = `{"keys":[]}`
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.jwksData(ctx, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["internal"] != `{"keys":[]}` {
+		t.Errorf("jwksData = %v, want the value of key jwks.json", data)
+	}
+}
+
+func TestPollJWKS(t *testing.T) {
+	ctx := context.Background()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{jwksIndex: jwksIndexFunc})
+	book := jwtBook()
+	unrelated := jwtBook()
+	unrelated.Name = "unrelated"
+	unrelated.Spec.Envoy.Auth.JWT.Providers[0].JWKS = bookv1.JWKSSource{Inline: `{"keys":[]}`}
+	for _, b := range []*bookv1.Book{book, unrelated} {
+		if err := indexer.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "book-api-jwks", Namespace: "default"},
+		Data:       map[string]string{"jwks.json": `{"keys":[]}`},
+	}
+	client := fake.NewSimpleClientset(configMap)
+	c := &Controller{
+		kubeclientset: client,
+		bookIndexers:  bookIndexers{indexer},
+		workqueue:     priorityqueue.New(workqueue.DefaultTypedControllerRateLimiter[cache.ObjectName](), priorityqueue.Config{}),
+	}
+	defer c.workqueue.ShutDown()
+	configMaps := client.CoreV1().ConfigMaps("default")
+
+	// poll runs pollJWKS and returns the Books it queued.
+	poll := func() []cache.ObjectName {
+		t.Helper()
+		c.pollJWKS(ctx)
+		var queued []cache.ObjectName
+		for c.workqueue.Len() > 0 {
+			item, _ := c.workqueue.Get()
+			c.workqueue.Done(item)
+			queued = append(queued, item)
+		}
+		return queued
+	}
+	want := []cache.ObjectName{cache.MetaObjectToName(book)}
+
+	if queued := poll(); len(queued) != 0 {
+		t.Errorf("first poll queued %v, want nothing", queued)
+	}
+	configMap.Data["jwks.json"] = `{"keys":[{}]}`
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if queued := poll(); !slices.Equal(queued, want) {
+		t.Errorf("poll after a change queued %v, want %v", queued, want)
+	}
+	if queued := poll(); len(queued) != 0 {
+		t.Errorf("poll without change queued %v, want nothing", queued)
+	}
+	if err := configMaps.Delete(ctx, configMap.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if queued := poll(); !slices.Equal(queued, want) {
+		t.Errorf("poll after a delete queued %v, want %v", queued, want)
+	}
+	if _, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if queued := poll(); !slices.Equal(queued, want) {
+		t.Errorf("poll after a create queued %v, want %v", queued, want)
+	}
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	informers "github.com/shiponcs/simple-custom-controller/pkg/generated/informers/externalversions/simplecustomcontroller/v1"
+	listers "github.com/shiponcs/simple-custom-controller/pkg/generated/listers/simplecustomcontroller/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerSet groups the informers watching a single namespace. Namespace is
+// metav1.NamespaceAll for informers watching the whole cluster.
+type InformerSet struct {
+	Namespace   string
+	Deployments appsinformers.DeploymentInformer
+	Services    coreinformers.ServiceInformer
+	Pods        coreinformers.PodInformer
+	Books       informers.BookInformer
+}
+
+// allSynced returns an InformerSynced that is true once every one of synced
+// is.
+func allSynced(synced []cache.InformerSynced) cache.InformerSynced {
+	return func() bool {
+		for _, hasSynced := range synced {
+			if !hasSynced() {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// bookIndexers are the indexers of the Book informers of every InformerSet.
+type bookIndexers []cache.Indexer
+
+// byIndex returns the Books of every indexer whose indexName index holds
+// key.
+func (b bookIndexers) byIndex(indexName, key string) ([]*bookv1.Book, error) {
+	var books []*bookv1.Book
+	for _, indexer := range b {
+		objects, err := indexer.ByIndex(indexName, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			books = append(books, obj.(*bookv1.Book))
+		}
+	}
+	return books, nil
+}
+
+// The listers below merge the listers of the InformerSets into one, keyed by
+// namespace. A lookup in a namespace that is not watched behaves like a
+// lookup in an empty cache.
+
+func emptyIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+}
+
+type mergedBookLister map[string]listers.BookLister
+
+func (m mergedBookLister) List(selector labels.Selector) ([]*bookv1.Book, error) {
+	var ret []*bookv1.Book
+	for _, lister := range m {
+		items, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, items...)
+	}
+	return ret, nil
+}
+
+func (m mergedBookLister) Books(namespace string) listers.BookNamespaceLister {
+	if lister, ok := m[namespace]; ok {
+		return lister.Books(namespace)
+	}
+	if lister, ok := m[metav1.NamespaceAll]; ok {
+		return lister.Books(namespace)
+	}
+	return listers.NewBookLister(emptyIndexer()).Books(namespace)
+}
+
+type mergedDeploymentLister map[string]appslisters.DeploymentLister
+
+func (m mergedDeploymentLister) List(selector labels.Selector) ([]*appsv1.Deployment, error) {
+	var ret []*appsv1.Deployment
+	for _, lister := range m {
+		items, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, items...)
+	}
+	return ret, nil
+}
+
+func (m mergedDeploymentLister) Deployments(namespace string) appslisters.DeploymentNamespaceLister {
+	if lister, ok := m[namespace]; ok {
+		return lister.Deployments(namespace)
+	}
+	if lister, ok := m[metav1.NamespaceAll]; ok {
+		return lister.Deployments(namespace)
+	}
+	return appslisters.NewDeploymentLister(emptyIndexer()).Deployments(namespace)
+}
+
+type mergedServiceLister map[string]corelisters.ServiceLister
+
+func (m mergedServiceLister) List(selector labels.Selector) ([]*corev1.Service, error) {
+	var ret []*corev1.Service
+	for _, lister := range m {
+		items, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, items...)
+	}
+	return ret, nil
+}
+
+func (m mergedServiceLister) Services(namespace string) corelisters.ServiceNamespaceLister {
+	if lister, ok := m[namespace]; ok {
+		return lister.Services(namespace)
+	}
+	if lister, ok := m[metav1.NamespaceAll]; ok {
+		return lister.Services(namespace)
+	}
+	return corelisters.NewServiceLister(emptyIndexer()).Services(namespace)
+}
+
+type mergedPodLister map[string]corelisters.PodLister
+
+func (m mergedPodLister) List(selector labels.Selector) ([]*corev1.Pod, error) {
+	var ret []*corev1.Pod
+	for _, lister := range m {
+		items, err := lister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, items...)
+	}
+	return ret, nil
+}
+
+func (m mergedPodLister) Pods(namespace string) corelisters.PodNamespaceLister {
+	if lister, ok := m[namespace]; ok {
+		return lister.Pods(namespace)
+	}
+	if lister, ok := m[metav1.NamespaceAll]; ok {
+		return lister.Pods(namespace)
+	}
+	return corelisters.NewPodLister(emptyIndexer()).Pods(namespace)
+}
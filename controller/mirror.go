@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/envoy"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ReasonMirroring is the MirrorReady reason of a Book whose requests are
+	// mirrored.
+	ReasonMirroring = "Mirroring"
+	// ReasonMirrorTargetNotFound is the MirrorReady reason of a Book
+	// mirroring to a Book that does not exist or serves no port.
+	ReasonMirrorTargetNotFound = "MirrorTargetNotFound"
+	// ReasonMirrorNeedsMutualTLS is the MirrorReady reason of a Book without
+	// mutual TLS mirroring to a Book that requires it.
+	ReasonMirrorNeedsMutualTLS = "MirrorNeedsMutualTLS"
+)
+
+// defaultMirrorPercent is the share of the requests mirrored when
+// spec.envoy.mirror.percent is not set.
+const defaultMirrorPercent = 100
+
+// envoyMirror resolves the Book that book mirrors its requests to, and
+// returns the MirrorReady condition telling whether it could. Both are nil
+// when book does not mirror. A missing target only drops the mirror, the
+// traffic of book is never held back by it.
+func (c *Controller) envoyMirror(book *bookv1.Book) (*envoy.Mirror, *metav1.Condition, error) {
+	if book.Spec.Envoy == nil || book.Spec.Envoy.Mirror == nil {
+		return nil, nil, nil
+	}
+	spec := book.Spec.Envoy.Mirror
+	if spec.Book == book.Name {
+		return nil, nil, terminalf(ReasonInvalidSpec, "spec.envoy.mirror.book must not be the Book itself")
+	}
+	notReady := func(reason, message string) (*envoy.Mirror, *metav1.Condition, error) {
+		return nil, &metav1.Condition{
+			Type:               bookv1.ConditionMirrorReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: book.Generation,
+		}, nil
+	}
+	target, err := c.bookLister.Books(book.Namespace).Get(spec.Book)
+	if errors.IsNotFound(err) {
+		return notReady(ReasonMirrorTargetNotFound, fmt.Sprintf("Book %s to mirror requests to does not exist", spec.Book))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if target.Spec.DeploymentName == "" || len(target.Spec.Container.Ports) == 0 {
+		return notReady(ReasonMirrorTargetNotFound, fmt.Sprintf("Book %s to mirror requests to serves no port", spec.Book))
+	}
+
+	// Envoy only has a client certificate when its own Book uses mutual
+	// TLS.
+	if mutualTLS(target) && !mutualTLS(book) {
+		return notReady(ReasonMirrorNeedsMutualTLS, fmt.Sprintf("Book %s to mirror requests to requires mutual TLS", spec.Book))
+	}
+
+	percent := int32(defaultMirrorPercent)
+	if spec.Percent != nil {
+		percent = *spec.Percent
+	}
+	return &envoy.Mirror{
+		Host:     upstreamHost(target),
+		Port:     target.Spec.Container.Ports[0].ContainerPort,
+		Protocol: servedProtocol(target),
+		TLS:      mutualTLS(target),
+		Percent:  percent,
+	}, &metav1.Condition{
+		Type:               bookv1.ConditionMirrorReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonMirroring,
+		Message:            fmt.Sprintf("%d%% of the requests are mirrored to Book %s", percent, spec.Book),
+		ObservedGeneration: book.Generation,
+	}, nil
+}
+
+// mirrorJustFailed reports whether the MirrorReady condition turned false,
+// or changed reason while false, between the stored status and next.
+func mirrorJustFailed(stored []metav1.Condition, next *metav1.Condition) bool {
+	if next == nil || next.Status != metav1.ConditionFalse {
+		return false
+	}
+	previous := meta.FindStatusCondition(stored, bookv1.ConditionMirrorReady)
+	return previous == nil || previous.Status != metav1.ConditionFalse || previous.Reason != next.Reason
+}
+
+// mirrorIndex indexes the Books by the Book they mirror their requests to.
+const mirrorIndex = "mirror"
+
+// mirrorIndexFunc returns the mirrorIndex key of a Book, the namespace/name
+// key of its mirror target.
+func mirrorIndexFunc(obj interface{}) ([]string, error) {
+	book, ok := obj.(*bookv1.Book)
+	if !ok || book.Spec.Envoy == nil || book.Spec.Envoy.Mirror == nil {
+		return nil, nil
+	}
+	return []string{cache.NewObjectName(book.Namespace, book.Spec.Envoy.Mirror.Book).String()}, nil
+}
+
+// enqueueMirroringBooks enqueues the Books that mirror their requests to
+// the Book obj, so that their envoy follows the Service of the target.
+func (c *Controller) enqueueMirroringBooks(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	target, ok := obj.(*bookv1.Book)
+	if !ok {
+		return
+	}
+	books, err := c.bookIndexers.byIndex(mirrorIndex, cache.MetaObjectToName(target).String())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, book := range books {
+		c.enqueueBook(book, priorityqueue.Normal)
+	}
+}
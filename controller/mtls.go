@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/certs"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// TLSHashAnnotation is set on the pod template of the book-server
+	// Deployment to the hash of its certificate, so that the pods are rolled
+	// out when the certificate is renewed.
+	TLSHashAnnotation = "simplecustomcontroller.crd.com/tls-hash"
+
+	// ServerTLSDir is where the certificate of the book-server, its key and
+	// the CA certificate are mounted in the book-server container.
+	ServerTLSDir = "/etc/book-server/tls"
+
+	// ReasonCertificatesIssued is the Event reason of a Book whose
+	// certificates were issued or renewed.
+	ReasonCertificatesIssued = "CertificatesIssued"
+
+	caCommonName = "simple-custom-controller"
+)
+
+// mutualTLS reports whether envoy and the book-server of book use mutual
+// TLS.
+func mutualTLS(book *bookv1.Book) bool {
+	return book.Spec.Envoy != nil && book.Spec.Envoy.Upstream != nil && book.Spec.Envoy.Upstream.MutualTLS
+}
+
+// SetMutualTLS changes the lifetime of the certificates issued from now on.
+// The CA Secret is read once and is not changed.
+func (c *Controller) SetMutualTLS(mutualTLS configv1alpha1.MutualTLSConfiguration) {
+	current := c.mutualTLS.Load()
+	mutualTLS.CASecretName = current.CASecretName
+	mutualTLS.CASecretNamespace = current.CASecretNamespace
+	c.mutualTLS.Store(&mutualTLS)
+}
+
+// tlsSecrets are the certificates of a Book using mutual TLS.
+type tlsSecrets struct {
+	// serverHash and envoyHash are the hashes of the Secrets of the
+	// book-server and of envoy.
+	serverHash string
+	envoyHash  string
+	status     *bookv1.TLSStatus
+}
+
+// hash returns the hash of the Secret of the book-server, empty without
+// mutual TLS.
+func (s *tlsSecrets) hash() string {
+	if s == nil {
+		return ""
+	}
+	return s.serverHash
+}
+
+// certificateAuthority returns the CA of the controller, read from its
+// Secret, which is created the first time. In dry-run mode the Secret is
+// not stored and a CA created then is not kept either: the next sync would
+// otherwise issue certificates from a CA that no replica can read.
+func (c *Controller) certificateAuthority(ctx context.Context) (*certs.CA, error) {
+	c.caMu.Lock()
+	defer c.caMu.Unlock()
+	if c.ca != nil {
+		return c.ca, nil
+	}
+
+	config := c.mutualTLS.Load()
+	secrets := c.kubeclientset.CoreV1().Secrets(config.CASecretNamespace)
+	secret, err := secrets.Get(ctx, config.CASecretName, metav1.GetOptions{})
+	stored := err == nil
+	if errors.IsNotFound(err) {
+		var ca *certs.CA
+		if ca, err = certs.NewCA(c.clock, caCommonName); err != nil {
+			return nil, err
+		}
+		keyPair := ca.KeyPair()
+		secret, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   config.CASecretName,
+				Labels: map[string]string{ManagedByLabel: ManagedByValue},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{certs.CertKey: keyPair.Cert, certs.KeyKey: keyPair.Key},
+		}, c.createOptions())
+		if errors.IsAlreadyExists(err) {
+			// Another replica was first.
+			secret, err = secrets.Get(ctx, config.CASecretName, metav1.GetOptions{})
+			stored = err == nil
+		} else if err == nil {
+			stored = c.dryRun == nil
+			klog.FromContext(ctx).Info("Created certificate authority", "secret", klog.KObj(secret))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate authority: %w", err)
+	}
+	ca, err := certs.ParseCA(c.clock, certs.KeyPair{Cert: secret.Data[certs.CertKey], Key: secret.Data[certs.KeyKey]})
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate authority %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	if stored {
+		c.ca = ca
+	}
+	return ca, nil
+}
+
+// syncCertificates makes sure the Secrets holding the certificates of the
+// book-server and of envoy exist and are not about to expire. It returns nil
+// when book does not use mutual TLS, after deleting the Secrets left from
+// when it did.
+func (c *Controller) syncCertificates(ctx context.Context, book *bookv1.Book) (secrets *tlsSecrets, err error) {
+	ctx, span := startStep(ctx, "Certificates")
+	defer func() { endSpan(span, err) }()
+
+	if !mutualTLS(book) {
+		if book.Status.TLS == nil {
+			return nil, nil
+		}
+		for _, name := range []string{serverSecretName(book), envoySecretName(book)} {
+			err := c.kubeclientset.CoreV1().Secrets(book.Namespace).Delete(ctx, name, c.deleteOptions())
+			recordChildOperation("Secret", metrics.OperationDelete, err)
+			if err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	ca, err := c.certificateAuthority(ctx)
+	if err != nil {
+		return nil, err
+	}
+	server, err := c.syncCertificateSecret(ctx, book, ca, serverSecretName(book), serverDNSNames(book), x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	envoy, err := c.syncCertificateSecret(ctx, book, ca, envoySecretName(book), envoyDNSNames(book), x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := server.notAfter
+	if envoy.notAfter.Before(notAfter) {
+		notAfter = envoy.notAfter
+	}
+	return &tlsSecrets{
+		serverHash: server.hash,
+		envoyHash:  envoy.hash,
+		status: &bookv1.TLSStatus{
+			NotAfter: metav1.NewTime(notAfter),
+			RenewAt:  metav1.NewTime(notAfter.Add(-c.mutualTLS.Load().RenewBefore.Duration)),
+		},
+	}, nil
+}
+
+// certificateSecret is the outcome of syncCertificateSecret.
+type certificateSecret struct {
+	hash     string
+	notAfter time.Time
+}
+
+// syncCertificateSecret makes sure the Secret name holds a certificate for
+// dnsNames issued by ca, renewing it when it is about to expire.
+func (c *Controller) syncCertificateSecret(ctx context.Context, book *bookv1.Book, ca *certs.CA, name string, dnsNames []string, usage x509.ExtKeyUsage) (*certificateSecret, error) {
+	config := c.mutualTLS.Load()
+	secrets := c.kubeclientset.CoreV1().Secrets(book.Namespace)
+	current, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	if exists {
+		if !metav1.IsControlledBy(current, book) {
+			return nil, terminalf(ErrResourceExists, MessageResourceExists, name)
+		}
+		if !ca.NeedsRenewal(current.Data[certs.CertKey], dnsNames, config.RenewBefore.Duration) &&
+			string(current.Data[certs.CAKey]) == string(ca.CertPEM()) {
+			return newCertificateSecret(current)
+		}
+	}
+
+	keyPair, err := ca.Issue(dnsNames[0], dnsNames, []x509.ExtKeyUsage{usage}, config.CertificateValidity.Duration)
+	if err != nil {
+		return nil, err
+	}
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: childLabels(book),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(book, bookv1.SchemeGroupVersion.WithKind("Book")),
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			certs.CertKey: keyPair.Cert,
+			certs.KeyKey:  keyPair.Key,
+			certs.CAKey:   ca.CertPEM(),
+		},
+	}
+	// Unlike the other children, the changes of the Secrets are not logged
+	// in dry-run mode, they hold private keys.
+	if !exists {
+		_, err = secrets.Create(ctx, desired, c.createOptions())
+		recordChildOperation("Secret", metrics.OperationCreate, err)
+	} else {
+		_, err = secrets.Update(ctx, desired, c.updateOptions())
+		recordChildOperation("Secret", metrics.OperationUpdate, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.event(ctx, book, corev1.EventTypeNormal, ReasonCertificatesIssued, fmt.Sprintf("Issued certificate in Secret %s", name))
+	return newCertificateSecret(desired)
+}
+
+func newCertificateSecret(secret *corev1.Secret) (*certificateSecret, error) {
+	notAfter, err := certs.NotAfter(secret.Data[certs.CertKey])
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{}
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	return &certificateSecret{hash: configHash(data), notAfter: notAfter}, nil
+}
+
+func serverSecretName(book *bookv1.Book) string {
+	return book.Spec.DeploymentName + "-server-tls"
+}
+
+func envoySecretName(book *bookv1.Book) string {
+	return book.Spec.DeploymentName + "-envoy-tls"
+}
+
+// serverDNSNames are the names of the Services of the book-server. The first
+// one, of the headless Service, is what envoy checks.
+func serverDNSNames(book *bookv1.Book) []string {
+	var names []string
+	for _, service := range []string{headlessServiceName(book), serviceName(book)} {
+		host := service + "." + book.Namespace + ".svc"
+		names = append(names, host, service, service+"."+book.Namespace, host+".cluster.local")
+	}
+	return names
+}
+
+func envoyDNSNames(book *bookv1.Book) []string {
+	return []string{fmt.Sprintf("%s-envoy.%s.svc", book.Spec.DeploymentName, book.Namespace)}
+}
+
+// tlsVolumes returns the volume of the certificate Secret name of book and
+// its mount at dir. There are none when book does not use mutual TLS.
+func tlsVolumes(book *bookv1.Book, name, dir string) ([]corev1.Volume, []corev1.VolumeMount) {
+	if !mutualTLS(book) {
+		return nil, nil
+	}
+	volume := corev1.Volume{
+		Name: "tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: name},
+		},
+	}
+	return []corev1.Volume{volume}, []corev1.VolumeMount{{Name: "tls", MountPath: dir, ReadOnly: true}}
+}
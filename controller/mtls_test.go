@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	configv1alpha1 "github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/certs"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+const (
+	testValidity    = 24 * time.Hour
+	testRenewBefore = 8 * time.Hour
+)
+
+// newTLSController returns a Controller issuing certificates with clock
+// from a fake API server.
+func newTLSController(clock *testingclock.FakeClock) (*Controller, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(100)
+	c := &Controller{
+		kubeclientset: fake.NewSimpleClientset(),
+		recorder:      recorder,
+		clock:         clock,
+	}
+	c.mutualTLS.Store(&configv1alpha1.MutualTLSConfiguration{
+		CASecretName:        "simple-custom-controller-ca",
+		CASecretNamespace:   "system",
+		CertificateValidity: metav1.Duration{Duration: testValidity},
+		RenewBefore:         metav1.Duration{Duration: testRenewBefore},
+	})
+	return c, recorder
+}
+
+func tlsBook() *bookv1.Book {
+	return &bookv1.Book{
+		ObjectMeta: metav1.ObjectMeta{Name: "book-api", Namespace: "default", UID: "uid"},
+		Spec: bookv1.BookSpec{
+			DeploymentName: "book-api",
+			Container: corev1.Container{
+				Name:  "book-server",
+				Ports: []corev1.ContainerPort{{ContainerPort: 8443}},
+			},
+			Envoy: &bookv1.EnvoySpec{
+				Upstream: &bookv1.UpstreamSpec{MutualTLS: true},
+			},
+		},
+	}
+}
+
+func serverCert(t *testing.T, c *Controller, book *bookv1.Book) []byte {
+	t.Helper()
+	secret, err := c.kubeclientset.CoreV1().Secrets(book.Namespace).Get(context.Background(), serverSecretName(book), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret.Data[certs.CertKey]
+}
+
+// issuedEvents returns how many CertificatesIssued Events were recorded
+// since the last call.
+func issuedEvents(recorder *record.FakeRecorder) int {
+	n := 0
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, ReasonCertificatesIssued) {
+				n++
+			}
+		default:
+			return n
+		}
+	}
+}
+
+func TestCertificateRenewal(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := testingclock.NewFakeClock(start)
+	c, recorder := newTLSController(clock)
+	book := tlsBook()
+
+	tls, err := c.syncCertificates(ctx, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := issuedEvents(recorder); n != 2 {
+		t.Fatalf("first sync issued %d certificates, want 2", n)
+	}
+	renewAt := start.Add(testValidity - testRenewBefore)
+	if !tls.status.RenewAt.Time.Equal(renewAt) {
+		t.Fatalf("RenewAt = %s, want %s", tls.status.RenewAt.Time, renewAt)
+	}
+	issued := serverCert(t, c, book)
+	ca, err := c.certificateAuthority(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnsNames := serverDNSNames(book)
+
+	clock.SetTime(renewAt.Add(-time.Second))
+	if ca.NeedsRenewal(issued, dnsNames, testRenewBefore) {
+		t.Errorf("certificate needs renewal a second before RenewAt")
+	}
+	if _, err := c.syncCertificates(ctx, book); err != nil {
+		t.Fatal(err)
+	}
+	if n := issuedEvents(recorder); n != 0 {
+		t.Errorf("sync before RenewAt issued %d certificates, want 0", n)
+	}
+	if !bytes.Equal(serverCert(t, c, book), issued) {
+		t.Errorf("certificate renewed before RenewAt")
+	}
+
+	clock.SetTime(renewAt)
+	if !ca.NeedsRenewal(issued, dnsNames, testRenewBefore) {
+		t.Errorf("certificate does not need renewal at RenewAt")
+	}
+	renewed, err := c.syncCertificates(ctx, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := issuedEvents(recorder); n != 2 {
+		t.Errorf("sync at RenewAt issued %d certificates, want 2", n)
+	}
+	if bytes.Equal(serverCert(t, c, book), issued) {
+		t.Errorf("certificate not renewed at RenewAt")
+	}
+	if want := renewAt.Add(testValidity - testRenewBefore); !renewed.status.RenewAt.Time.Equal(want) {
+		t.Errorf("RenewAt after renewal = %s, want %s", renewed.status.RenewAt.Time, want)
+	}
+	if renewed.serverHash == tls.serverHash || renewed.envoyHash == tls.envoyHash {
+		t.Errorf("Secret hashes unchanged by the renewal, the pods would not be rolled out")
+	}
+}
+
+func TestCertificateAuthorityDryRun(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTLSController(testingclock.NewFakeClock(time.Now()))
+	c.dryRun = newDryRunReport()
+
+	if _, err := c.certificateAuthority(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.ca != nil {
+		t.Errorf("CA created in dry-run mode was cached")
+	}
+
+	c.dryRun = nil
+	if _, err := c.certificateAuthority(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.ca == nil {
+		t.Errorf("CA read from its Secret was not cached")
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// PodSelector selects the book-server and envoy pods. The Pod informers
+	// only watch those.
+	PodSelector = "app in (book-server,envoy),controller"
+
+	// maxPodIssues bounds status.podIssues.
+	maxPodIssues = 10
+	// maxPodIssueMessage bounds the message of a PodIssue.
+	maxPodIssueMessage = 256
+)
+
+// benignWaitingReasons are the waiting reasons of a container that is
+// starting normally.
+var benignWaitingReasons = map[string]bool{
+	"ContainerCreating": true,
+	"PodInitializing":   true,
+}
+
+// bookForPod returns the Book owning pod, or nil. The pod carries the name
+// of the Book in its controller label, and must be owned by a ReplicaSet of
+// one of the Deployments of that Book.
+func (c *Controller) bookForPod(pod *corev1.Pod) *bookv1.Book {
+	bookName := pod.Labels["controller"]
+	if bookName == "" {
+		return nil
+	}
+	book, err := c.bookLister.Books(pod.Namespace).Get(bookName)
+	if err != nil || !ownedByBook(pod, book) {
+		return nil
+	}
+	return book
+}
+
+// ownedByBook reports whether pod belongs to a ReplicaSet of the book-server
+// or of the envoy Deployment of book. The ReplicaSets of a Deployment are
+// named after the Deployment and the pod-template-hash label of their pods.
+func ownedByBook(pod *corev1.Pod, book *bookv1.Book) bool {
+	ownerRef := metav1.GetControllerOf(pod)
+	hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	if ownerRef == nil || ownerRef.Kind != "ReplicaSet" || hash == "" {
+		return false
+	}
+	for _, deploymentName := range []string{book.Spec.DeploymentName, book.Spec.DeploymentName + "-envoy"} {
+		if ownerRef.Name == deploymentName+"-"+hash {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePod enqueues the Book owning a pod that changed.
+func (c *Controller) handlePod(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if book := c.bookForPod(pod); book != nil {
+		c.enqueueBook(book, priorityqueue.Normal)
+	}
+}
+
+// podIssues summarises the problems of the pods of book, at most
+// maxPodIssues of them.
+func (c *Controller) podIssues(book *bookv1.Book) ([]bookv1.PodIssue, error) {
+	selector, err := labels.Parse(PodSelector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.podLister.Pods(book.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []bookv1.PodIssue
+	for _, pod := range pods {
+		if pod.Labels["controller"] == book.Name && ownedByBook(pod, book) {
+			issues = append(issues, issuesOfPod(pod)...)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Pod != issues[j].Pod {
+			return issues[i].Pod < issues[j].Pod
+		}
+		return issues[i].Container < issues[j].Container
+	})
+	if len(issues) > maxPodIssues {
+		issues = issues[:maxPodIssues]
+	}
+	return issues, nil
+}
+
+// issuesOfPod returns the problems of a single pod.
+func issuesOfPod(pod *corev1.Pod) []bookv1.PodIssue {
+	var issues []bookv1.PodIssue
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			issues = append(issues, bookv1.PodIssue{
+				Pod:     pod.Name,
+				Reason:  condition.Reason,
+				Message: truncate(condition.Message),
+			})
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		issue := bookv1.PodIssue{
+			Pod:          pod.Name,
+			Container:    status.Name,
+			RestartCount: status.RestartCount,
+		}
+		switch {
+		case status.State.Waiting != nil && !benignWaitingReasons[status.State.Waiting.Reason]:
+			issue.Reason = status.State.Waiting.Reason
+			issue.Message = status.State.Waiting.Message
+		case status.State.Terminated != nil && status.State.Terminated.ExitCode != 0:
+			issue.Reason = status.State.Terminated.Reason
+			issue.Message = status.State.Terminated.Message
+		default:
+			continue
+		}
+		if last := status.LastTerminationState.Terminated; issue.Message == "" && last != nil {
+			issue.Message = fmt.Sprintf("last termination: %s (exit code %d)", last.Reason, last.ExitCode)
+			if last.Message != "" {
+				issue.Message += ": " + last.Message
+			}
+		}
+		issue.Message = truncate(issue.Message)
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+func truncate(message string) string {
+	if len(message) <= maxPodIssueMessage {
+		return message
+	}
+	return message[:maxPodIssueMessage-3] + "..."
+}
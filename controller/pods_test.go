@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+// bookPod returns a pod of the book-server Deployment of tlsBook, owned by
+// the ReplicaSet ownerName.
+func bookPod(name, ownerName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				"app":                                  "book-server",
+				"controller":                           "book-api",
+				appsv1.DefaultDeploymentUniqueLabelKey: "7d9f",
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       ownerName,
+				Controller: ptr.To(true),
+			}},
+		},
+	}
+}
+
+func crashingStatus(name string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: 4,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+		LastTerminationState: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1, Message: "listen tcp :8443: bind: address already in use"},
+		},
+	}
+}
+
+func TestIssuesOfPod(t *testing.T) {
+	tests := []struct {
+		name   string
+		status corev1.PodStatus
+		want   []bookv1.PodIssue
+	}{
+		{
+			name: "running",
+			status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "book-server",
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				}},
+			},
+		},
+		{
+			name: "benign waiting reasons",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "init",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}},
+				}},
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "book-server",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+				}},
+			},
+		},
+		{
+			name: "unschedulable",
+			status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{
+					Type:    corev1.PodScheduled,
+					Status:  corev1.ConditionFalse,
+					Reason:  "Unschedulable",
+					Message: "0/3 nodes are available: 3 Insufficient cpu.",
+				}},
+			},
+			want: []bookv1.PodIssue{{Pod: "book-api-7d9f-x", Reason: "Unschedulable", Message: "0/3 nodes are available: 3 Insufficient cpu."}},
+		},
+		{
+			name: "image pull error",
+			status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "book-server",
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: `pull access denied for "book-server:v3"`},
+					},
+				}},
+			},
+			want: []bookv1.PodIssue{{Pod: "book-api-7d9f-x", Container: "book-server", Reason: "ErrImagePull", Message: `pull access denied for "book-server:v3"`}},
+		},
+		{
+			name: "last termination fallback",
+			status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{crashingStatus("book-server")},
+			},
+			want: []bookv1.PodIssue{{
+				Pod:          "book-api-7d9f-x",
+				Container:    "book-server",
+				Reason:       "CrashLoopBackOff",
+				Message:      "last termination: Error (exit code 1): listen tcp :8443: bind: address already in use",
+				RestartCount: 4,
+			}},
+		},
+		{
+			name: "failed init container",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name: "init",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 2},
+					},
+				}},
+			},
+			want: []bookv1.PodIssue{{Pod: "book-api-7d9f-x", Container: "init", Reason: "Error"}},
+		},
+		{
+			name: "completed init container",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name: "init",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"},
+					},
+				}},
+			},
+		},
+		{
+			name: "long message truncated",
+			status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "book-server",
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "CreateContainerConfigError", Message: strings.Repeat("x", 300)},
+					},
+				}},
+			},
+			want: []bookv1.PodIssue{{
+				Pod:       "book-api-7d9f-x",
+				Container: "book-server",
+				Reason:    "CreateContainerConfigError",
+				Message:   strings.Repeat("x", maxPodIssueMessage-3) + "...",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := bookPod("book-api-7d9f-x", "book-api-7d9f")
+			pod.Status = tt.status
+			if got := issuesOfPod(pod); !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("issuesOfPod() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnedByBook(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*corev1.Pod)
+		want   bool
+	}{
+		{
+			name: "book-server ReplicaSet",
+			want: true,
+		},
+		{
+			name: "envoy ReplicaSet",
+			mutate: func(pod *corev1.Pod) {
+				pod.OwnerReferences[0].Name = "book-api-envoy-7d9f"
+			},
+			want: true,
+		},
+		{
+			// The controller label is right but the pod belongs to
+			// another Deployment.
+			name: "ReplicaSet of another Deployment",
+			mutate: func(pod *corev1.Pod) {
+				pod.OwnerReferences[0].Name = "book-api-canary-7d9f"
+			},
+		},
+		{
+			name: "ReplicaSet of another template",
+			mutate: func(pod *corev1.Pod) {
+				pod.OwnerReferences[0].Name = "book-api-5c4b"
+			},
+		},
+		{
+			name: "no pod-template-hash",
+			mutate: func(pod *corev1.Pod) {
+				delete(pod.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+			},
+		},
+		{
+			name: "not the controller",
+			mutate: func(pod *corev1.Pod) {
+				pod.OwnerReferences[0].Controller = nil
+			},
+		},
+		{
+			name: "owned by a StatefulSet",
+			mutate: func(pod *corev1.Pod) {
+				pod.OwnerReferences[0].Kind = "StatefulSet"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := bookPod("book-api-7d9f-x", "book-api-7d9f")
+			if tt.mutate != nil {
+				tt.mutate(pod)
+			}
+			if got := ownedByBook(pod, tlsBook()); got != tt.want {
+				t.Errorf("ownedByBook() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{message: "", want: ""},
+		{message: "short", want: "short"},
+		{message: strings.Repeat("x", maxPodIssueMessage), want: strings.Repeat("x", maxPodIssueMessage)},
+		{message: strings.Repeat("x", maxPodIssueMessage+1), want: strings.Repeat("x", maxPodIssueMessage-3) + "..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.message); got != tt.want {
+			t.Errorf("truncate() of %d bytes = %d bytes %q..., want %d bytes", len(tt.message), len(got), got[:min(len(got), 10)], len(tt.want))
+		}
+	}
+}
+
+func TestPodIssues(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for i := 0; i < maxPodIssues+5; i++ {
+		pod := bookPod(fmt.Sprintf("book-api-7d9f-%02d", i), "book-api-7d9f")
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{crashingStatus("book-server")}
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A pod labelled for the Book but owned by another ReplicaSet is not
+	// reported, however it sorts.
+	stray := bookPod("book-api-7d9f-00a", "book-api-canary-7d9f")
+	stray.Status.ContainerStatuses = []corev1.ContainerStatus{crashingStatus("book-server")}
+	if err := indexer.Add(stray); err != nil {
+		t.Fatal(err)
+	}
+	c := &Controller{podLister: mergedPodLister{metav1.NamespaceAll: corelisters.NewPodLister(indexer)}}
+
+	issues, err := c.podIssues(tlsBook())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != maxPodIssues {
+		t.Fatalf("podIssues() returned %d issues, want %d", len(issues), maxPodIssues)
+	}
+	for i, issue := range issues {
+		if want := fmt.Sprintf("book-api-7d9f-%02d", i); issue.Pod != want {
+			t.Errorf("issue %d of pod %s, want %s", i, issue.Pod, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RevisionAnnotation is set by the Deployment controller to the revision
+	// of the Deployment.
+	RevisionAnnotation = "deployment.kubernetes.io/revision"
+
+	// ReasonRolloutFailed is the Event reason of a rollout that exceeded its
+	// progress deadline.
+	ReasonRolloutFailed = "RolloutFailed"
+	// progressDeadlineExceeded is the reason of the Progressing condition of
+	// a Deployment whose rollout stalled.
+	progressDeadlineExceeded = "ProgressDeadlineExceeded"
+)
+
+// rolloutStatus derives the state of the rollout of deployment the way
+// kubectl rollout status does.
+func rolloutStatus(deployment *appsv1.Deployment) *bookv1.RolloutStatus {
+	status := &bookv1.RolloutStatus{
+		Revision:        deployment.Annotations[RevisionAnnotation],
+		UpdatedReplicas: deployment.Status.UpdatedReplicas,
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		status.Image = containers[0].Image
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		status.State = bookv1.RolloutProgressing
+		status.Message = "waiting for the Deployment spec update to be observed"
+		return status
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == progressDeadlineExceeded {
+			status.State = bookv1.RolloutFailed
+			status.Message = condition.Message
+			return status
+		}
+	}
+
+	switch {
+	case deployment.Status.UpdatedReplicas < replicas:
+		status.State = bookv1.RolloutProgressing
+		status.Message = fmt.Sprintf("%d of %d replicas updated", deployment.Status.UpdatedReplicas, replicas)
+	case deployment.Status.Replicas > deployment.Status.UpdatedReplicas:
+		status.State = bookv1.RolloutProgressing
+		status.Message = fmt.Sprintf("%d old replicas pending termination", deployment.Status.Replicas-deployment.Status.UpdatedReplicas)
+	case deployment.Status.AvailableReplicas < deployment.Status.UpdatedReplicas:
+		status.State = bookv1.RolloutProgressing
+		status.Message = fmt.Sprintf("%d of %d updated replicas available", deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas)
+	default:
+		status.State = bookv1.RolloutComplete
+	}
+	return status
+}
+
+// rolloutJustFailed reports whether current is a failed rollout that was
+// not already reported in previous.
+func rolloutJustFailed(previous, current *bookv1.RolloutStatus) bool {
+	if current.State != bookv1.RolloutFailed {
+		return false
+	}
+	return previous == nil || previous.State != bookv1.RolloutFailed || previous.Revision != current.Revision
+}
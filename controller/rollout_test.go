@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"testing"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// rolloutDeployment returns a Deployment of revision 2 with 3 replicas, all
+// of them updated and available.
+func rolloutDeployment(mutate func(*appsv1.Deployment)) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "book-api",
+			Generation:  4,
+			Annotations: map[string]string{RevisionAnnotation: "2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](3),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "book-server", Image: "book-server:v2"}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 4,
+			Replicas:           3,
+			UpdatedReplicas:    3,
+			AvailableReplicas:  3,
+		},
+	}
+	if mutate != nil {
+		mutate(deployment)
+	}
+	return deployment
+}
+
+func TestRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*appsv1.Deployment)
+		wantState   bookv1.RolloutState
+		wantMessage string
+	}{
+		{
+			name:      "complete",
+			wantState: bookv1.RolloutComplete,
+		},
+		{
+			name: "spec update not observed",
+			mutate: func(d *appsv1.Deployment) {
+				d.Generation = 5
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "waiting for the Deployment spec update to be observed",
+		},
+		{
+			// The condition may be left over from the previous
+			// generation, which the new spec could fix.
+			name: "spec update not observed after a deadline exceeded",
+			mutate: func(d *appsv1.Deployment) {
+				d.Generation = 5
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentProgressing,
+					Status: corev1.ConditionFalse,
+					Reason: progressDeadlineExceeded,
+				}}
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "waiting for the Deployment spec update to be observed",
+		},
+		{
+			name: "progress deadline exceeded",
+			mutate: func(d *appsv1.Deployment) {
+				d.Status.UpdatedReplicas = 1
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:    appsv1.DeploymentProgressing,
+					Status:  corev1.ConditionFalse,
+					Reason:  progressDeadlineExceeded,
+					Message: `ReplicaSet "book-api-7d9f" has timed out progressing.`,
+				}}
+			},
+			wantState:   bookv1.RolloutFailed,
+			wantMessage: `ReplicaSet "book-api-7d9f" has timed out progressing.`,
+		},
+		{
+			name: "progressing",
+			mutate: func(d *appsv1.Deployment) {
+				d.Status.UpdatedReplicas = 1
+				d.Status.Conditions = []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentProgressing,
+					Status: corev1.ConditionTrue,
+					Reason: "ReplicaSetUpdated",
+				}}
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "1 of 3 replicas updated",
+		},
+		{
+			name: "old replicas pending termination",
+			mutate: func(d *appsv1.Deployment) {
+				d.Status.Replicas = 5
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "2 old replicas pending termination",
+		},
+		{
+			name: "updated replicas not available",
+			mutate: func(d *appsv1.Deployment) {
+				d.Status.AvailableReplicas = 2
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "2 of 3 updated replicas available",
+		},
+		{
+			name: "replicas defaulted to 1",
+			mutate: func(d *appsv1.Deployment) {
+				d.Spec.Replicas = nil
+				d.Status.Replicas = 1
+				d.Status.UpdatedReplicas = 0
+				d.Status.AvailableReplicas = 1
+			},
+			wantState:   bookv1.RolloutProgressing,
+			wantMessage: "0 of 1 replicas updated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := rolloutDeployment(tt.mutate)
+			status := rolloutStatus(deployment)
+			if status.State != tt.wantState || status.Message != tt.wantMessage {
+				t.Errorf("rolloutStatus() = %s %q, want %s %q", status.State, status.Message, tt.wantState, tt.wantMessage)
+			}
+			if status.Revision != "2" || status.Image != "book-server:v2" || status.UpdatedReplicas != deployment.Status.UpdatedReplicas {
+				t.Errorf("rolloutStatus() = revision %q, image %q, %d updated replicas, want 2, book-server:v2, %d",
+					status.Revision, status.Image, status.UpdatedReplicas, deployment.Status.UpdatedReplicas)
+			}
+		})
+	}
+}
+
+func TestRolloutJustFailed(t *testing.T) {
+	failed := func(revision string) *bookv1.RolloutStatus {
+		return &bookv1.RolloutStatus{State: bookv1.RolloutFailed, Revision: revision}
+	}
+	tests := []struct {
+		name     string
+		previous *bookv1.RolloutStatus
+		current  *bookv1.RolloutStatus
+		want     bool
+	}{
+		{
+			name:     "first status failed",
+			previous: nil,
+			current:  failed("2"),
+			want:     true,
+		},
+		{
+			name:     "progressing rollout failed",
+			previous: &bookv1.RolloutStatus{State: bookv1.RolloutProgressing, Revision: "2"},
+			current:  failed("2"),
+			want:     true,
+		},
+		{
+			name:     "failure already reported",
+			previous: failed("2"),
+			current:  failed("2"),
+			want:     false,
+		},
+		{
+			name:     "next revision failed too",
+			previous: failed("2"),
+			current:  failed("3"),
+			want:     true,
+		},
+		{
+			name:     "progressing",
+			previous: nil,
+			current:  &bookv1.RolloutStatus{State: bookv1.RolloutProgressing, Revision: "2"},
+			want:     false,
+		},
+		{
+			name:     "recovered",
+			previous: failed("2"),
+			current:  &bookv1.RolloutStatus{State: bookv1.RolloutComplete, Revision: "3"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolloutJustFailed(tt.previous, tt.current); got != tt.want {
+				t.Errorf("rolloutJustFailed() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/shiponcs/simple-custom-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TraceIDAnnotation is set on the Events emitted during a traced reconcile so
+// that an Event can be matched with its trace.
+const TraceIDAnnotation = "simplecustomcontroller.crd.com/trace-id"
+
+// startStep opens a child span for one step of the reconcile, typically the
+// sync of one owned object.
+func startStep(ctx context.Context, step string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "sync"+step, trace.WithAttributes(attribute.String("step", step)))
+}
+
+// endSpan records the outcome of the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attribute.String("outcome", "error"))
+	} else {
+		span.SetAttributes(attribute.String("outcome", "success"))
+	}
+	span.End()
+}
+
+// event records an Event for object. When ctx carries a trace the trace ID
+// is added as an annotation of the Event. No Event is recorded in dry-run
+// mode.
+func (c *Controller) event(ctx context.Context, object runtime.Object, eventtype, reason, message string) {
+	if c.dryRun != nil {
+		return
+	}
+	traceID := tracing.TraceID(ctx)
+	if traceID == "" {
+		c.recorder.Event(object, eventtype, reason, message)
+		return
+	}
+	c.recorder.AnnotatedEventf(object, map[string]string{TraceIDAnnotation: traceID}, eventtype, reason, "%s", message)
+}
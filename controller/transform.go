@@ -0,0 +1,31 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// strippedAnnotations are dropped from the cached objects. The controller
+// never reads them and they can be as large as the object itself.
+var strippedAnnotations = []string{
+	corev1.LastAppliedConfigAnnotation,
+}
+
+// TransformObject drops the parts of an object the controller never reads
+// before it is stored in an informer cache: the managed fields and the
+// strippedAnnotations. It is meant to be installed on the informer factories
+// with WithTransform.
+func TransformObject(obj interface{}) (interface{}, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		// Tombstones are stored as they are.
+		return obj, nil
+	}
+	accessor.SetManagedFields(nil)
+	if annotations := accessor.GetAnnotations(); annotations != nil {
+		for _, annotation := range strippedAnnotations {
+			delete(annotations, annotation)
+		}
+	}
+	return obj, nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kuberuntime "k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// BenchmarkDeploymentCache fills a Deployment informer cache from n
+// synthetic Deployments, half of them created by the controller, the way
+// main.go sets the informers up and without the selector and the transform.
+// retained-B/op is the heap held by the filled cache.
+func BenchmarkDeploymentCache(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		client := fake.NewSimpleClientset(syntheticDeployments(n)...)
+		for _, tc := range []struct {
+			name    string
+			options []kubeinformers.SharedInformerOption
+		}{
+			{name: "unfiltered"},
+			{name: "filtered", options: []kubeinformers.SharedInformerOption{
+				kubeinformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+					opts.LabelSelector = ManagedByLabel + "=" + ManagedByValue
+				}),
+				kubeinformers.WithTransform(TransformObject),
+			}},
+		} {
+			b.Run(fmt.Sprintf("%s/%d", tc.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				var retained int64
+				for i := 0; i < b.N; i++ {
+					before := heapAlloc()
+					ctx, cancel := context.WithCancel(context.Background())
+					factory := kubeinformers.NewSharedInformerFactoryWithOptions(client, 0, tc.options...)
+					informer := factory.Apps().V1().Deployments().Informer()
+					factory.Start(ctx.Done())
+					factory.WaitForCacheSync(ctx.Done())
+					retained += heapAlloc() - before
+					if i == 0 {
+						b.Logf("%d Deployments cached", len(informer.GetStore().ListKeys()))
+					}
+					cancel()
+					factory.Shutdown()
+				}
+				b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+			})
+		}
+	}
+}
+
+// syntheticDeployments returns n Deployments carrying managed fields and a
+// last-applied-configuration annotation, every other one labeled as created
+// by the controller.
+func syntheticDeployments(n int) []kuberuntime.Object {
+	lastApplied := `{"apiVersion":"apps/v1","kind":"Deployment","spec":{"template":{"spec":{"containers":[{"image":"` +
+		strings.Repeat("x", 2048) + `"}]}}}}`
+	fieldsV1 := `{"f:spec":{"f:template":{"f:spec":{"f:containers":{` + strings.Repeat(`"f:x":{},`, 128) + `"f:y":{}}}}}}`
+	objects := make([]kuberuntime.Object, 0, n)
+	for i := 0; i < n; i++ {
+		labels := map[string]string{"app": "other"}
+		if i%2 == 0 {
+			labels = map[string]string{ManagedByLabel: ManagedByValue, BookLabel: fmt.Sprintf("book-%d", i)}
+		}
+		objects = append(objects, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("deployment-%d", i),
+				Namespace:   metav1.NamespaceDefault,
+				Labels:      labels,
+				Annotations: map[string]string{corev1.LastAppliedConfigAnnotation: lastApplied},
+				ManagedFields: []metav1.ManagedFieldsEntry{{
+					Manager:    "kubectl",
+					Operation:  metav1.ManagedFieldsOperationApply,
+					APIVersion: "apps/v1",
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(fieldsV1)},
+				}},
+			},
+		})
+	}
+	return objects
+}
+
+// heapAlloc returns the live heap after a garbage collection.
+func heapAlloc() int64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"github.com/shiponcs/simple-custom-controller/controller"
+	"github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	"github.com/shiponcs/simple-custom-controller/pkg/config"
 	clientset "github.com/shiponcs/simple-custom-controller/pkg/generated/clientset/versioned"
 	_ "github.com/shiponcs/simple-custom-controller/pkg/generated/informers/externalversions/simplecustomcontroller/v1"
+	"github.com/shiponcs/simple-custom-controller/pkg/healthz"
+	"github.com/shiponcs/simple-custom-controller/pkg/metrics"
+	"github.com/shiponcs/simple-custom-controller/pkg/sharding"
 	"github.com/shiponcs/simple-custom-controller/pkg/signals"
+	"github.com/shiponcs/simple-custom-controller/pkg/tracing"
 	_ "golang.org/x/time/rate"
 	_ "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	_ "k8s.io/client-go/informers/apps/v1"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -19,6 +30,8 @@ import (
 	"k8s.io/klog/v2"
 	_ "k8s.io/klog/v2"
 	_ "k8s.io/sample-controller/pkg/generated/clientset/versioned/scheme"
+	"net/http"
+	"os"
 	"time"
 
 	//"context"
@@ -26,20 +39,50 @@ import (
 	bookInformers "github.com/shiponcs/simple-custom-controller/pkg/generated/informers/externalversions"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 )
 
 func main() {
 	klog.InitFlags(nil)
 	ctx := signals.SetupSignalHandler()
+	reload := signals.SetupReloadHandler()
 	logger := klog.FromContext(ctx)
 
-	var kubeconfig string
-	flag.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
+	controllerConfig := config.Default()
+	var configFile string
+	var shardID string
+	var watchdogTimeout time.Duration
+	var dryRun bool
+	var tracingOpts tracing.Options
+	flag.StringVar(&configFile, "config", "", "path to a ControllerConfiguration file, flags set explicitly take precedence over it")
+	addConfigFlags(flag.CommandLine, controllerConfig)
+	flag.StringVar(&shardID, "shard-id", os.Getenv("POD_NAME"), "identity of this replica, defaults to the pod name")
+	flag.BoolVar(&dryRun, "dry-run", false, "log the changes the controller would make without making them")
+	flag.DurationVar(&watchdogTimeout, "watchdog-timeout", 2*time.Minute, "fail the liveness probe when queued items see no progress for this long")
+	flag.StringVar(&tracingOpts.Exporter, "tracing-exporter", tracing.ExporterNone, "where reconcile traces are sent: none, otlp, stdout or file")
+	flag.StringVar(&tracingOpts.Endpoint, "tracing-otlp-endpoint", "", "host:port of the OTLP/HTTP collector, defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	flag.BoolVar(&tracingOpts.Insecure, "tracing-otlp-insecure", false, "send traces to the OTLP collector without TLS")
+	flag.StringVar(&tracingOpts.File, "tracing-file", "traces.json", "file the traces are appended to with the file exporter")
+	flag.Float64Var(&tracingOpts.SampleRatio, "tracing-sample-ratio", 1, "fraction of the reconciles that are traced")
 	flag.Parse()
 
+	if configFile != "" {
+		fileConfig, err := loadConfig(configFile, flag.CommandLine)
+		if err != nil {
+			logger.Error(err, "Error loading configuration", "file", configFile)
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		controllerConfig = fileConfig
+	} else if err := config.Validate(controllerConfig); err != nil {
+		logger.Error(err, "Invalid configuration")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
 	var cfg *rest.Config
 	var err error
 
+	kubeconfig := controllerConfig.ClientConnection.Kubeconfig
 	if kubeconfig == "" {
 		logger.V(4).Info("Running in in-cluster mode")
 		cfg, err = rest.InClusterConfig()
@@ -51,7 +94,24 @@ func main() {
 		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
 			logger.V(4).Error(err, "Error running in out-cluster mode")
+			return
+		}
+	}
+	cfg.QPS = controllerConfig.ClientConnection.QPS
+	cfg.Burst = int(controllerConfig.ClientConnection.Burst)
+
+	shutdownTracing, err := tracing.Setup(ctx, "simple-custom-controller", tracingOpts)
+	if err != nil {
+		logger.Error(err, "Error setting up tracing")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error(err, "Error flushing traces")
 		}
+	}()
+	if tracingOpts.Exporter != tracing.ExporterNone {
+		tracing.WrapConfig(cfg)
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
@@ -64,19 +124,261 @@ func main() {
 		panic(err.Error())
 	}
 
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	bookInformerFactory := bookInformers.NewSharedInformerFactory(bookClient, time.Second*30)
+	// One pair of informer factories is started per watched namespace. The
+	// Deployments and Services are restricted to the ones created by the
+	// controller, the Books to the ones matching the selector. The parts of
+	// the objects the controller never reads are not cached.
+	resync := controllerConfig.ResyncPeriod.Duration
+	namespaces := controllerConfig.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	var kubeInformerFactories, podInformerFactories []kubeinformers.SharedInformerFactory
+	var bookInformerFactories []bookInformers.SharedInformerFactory
+	var informerSets []controller.InformerSet
+	for _, namespace := range namespaces {
+		kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+			kubeinformers.WithNamespace(namespace),
+			kubeinformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = controller.ManagedByLabel + "=" + controller.ManagedByValue
+			}),
+			kubeinformers.WithTransform(controller.TransformObject))
+		podInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+			kubeinformers.WithNamespace(namespace),
+			kubeinformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = controller.PodSelector
+			}),
+			kubeinformers.WithTransform(controller.TransformObject))
+		bookInformerFactory := bookInformers.NewSharedInformerFactoryWithOptions(bookClient, resync,
+			bookInformers.WithNamespace(namespace),
+			bookInformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = controllerConfig.BookSelector
+			}),
+			bookInformers.WithTransform(controller.TransformObject))
+		kubeInformerFactories = append(kubeInformerFactories, kubeInformerFactory)
+		podInformerFactories = append(podInformerFactories, podInformerFactory)
+		bookInformerFactories = append(bookInformerFactories, bookInformerFactory)
+		informerSets = append(informerSets, controller.InformerSet{
+			Namespace:   namespace,
+			Deployments: kubeInformerFactory.Apps().V1().Deployments(),
+			Services:    kubeInformerFactory.Core().V1().Services(),
+			Pods:        podInformerFactory.Core().V1().Pods(),
+			Books:       bookInformerFactory.Simplecustomcontroller().V1().Books(),
+		})
+	}
 
-	controller := controller.NewController(ctx, kubeClient, bookClient,
-		kubeInformerFactory.Apps().V1().Deployments(),
-		kubeInformerFactory.Core().V1().Services(),
-		bookInformerFactory.Simplecustomcontroller().V1().Books())
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	podNamespace := os.Getenv("POD_NAMESPACE")
+	if podNamespace == "" {
+		podNamespace = metav1.NamespaceDefault
+	}
 
-	kubeInformerFactory.Start(ctx.Done())
-	bookInformerFactory.Start(ctx.Done())
+	var coordinator *sharding.Coordinator
+	opts := controller.Options{
+		ResyncPeriod:        controllerConfig.ResyncPeriod.Duration,
+		RateLimiter:         controllerConfig.RateLimiter,
+		Envoy:               controllerConfig.Envoy,
+		ReconcileTimeout:    controllerConfig.ReconcileTimeout.Duration,
+		ShutdownGracePeriod: controllerConfig.ShutdownGracePeriod.Duration,
+		DryRun:              dryRun,
+		MutualTLS:           controllerConfig.MutualTLS,
+	}
+	if opts.MutualTLS.CASecretNamespace == "" {
+		opts.MutualTLS.CASecretNamespace = podNamespace
+	}
+	if controllerConfig.Sharding.Enabled {
+		shardConfig := sharding.Config{
+			Namespace:     controllerConfig.Sharding.Namespace,
+			Group:         controllerConfig.Sharding.Group,
+			Identity:      shardID,
+			LeaseDuration: controllerConfig.Sharding.LeaseDuration.Duration,
+			RenewInterval: controllerConfig.Sharding.RenewInterval.Duration,
+		}
+		if shardConfig.Identity == "" {
+			shardConfig.Identity = identity
+		}
+		if shardConfig.Namespace == "" {
+			shardConfig.Namespace = podNamespace
+		}
+		coordinator = sharding.NewCoordinator(kubeClient, shardConfig)
+		opts.Sharder = coordinator
+	}
 
-	if err := controller.Run(ctx, 2); err != nil {
-		logger.Error(err, "Error running controller")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	controller := controller.NewController(ctx, kubeClient, bookClient, informerSets, opts)
+
+	for _, factory := range append(kubeInformerFactories, podInformerFactories...) {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range bookInformerFactories {
+		factory.Start(ctx.Done())
+	}
+
+	run := func(ctx context.Context) {
+		if err := controller.Run(ctx, int(controllerConfig.Workers)); err != nil {
+			logger.Error(err, "Error running controller")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	}
+
+	livenessChecks := []healthz.Checker{healthz.Ping,
+		{Name: "watchdog", Check: controller.Watchdog(watchdogTimeout)}}
+	readinessChecks := []healthz.Checker{healthz.Ping,
+		{Name: "informer-sync", Check: controller.CachesSynced}}
+
+	var elector *leaderelection.LeaderElector
+	runDone := make(chan struct{})
+	if controllerConfig.LeaderElection.LeaderElect {
+		leaderElection := controllerConfig.LeaderElection
+		if leaderElection.ResourceNamespace == "" {
+			leaderElection.ResourceNamespace = podNamespace
+		}
+		watchdog := leaderelection.NewLeaderHealthzAdaptor(20 * time.Second)
+		elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta: metav1.ObjectMeta{
+					Name:      leaderElection.ResourceName,
+					Namespace: leaderElection.ResourceNamespace,
+				},
+				Client:     kubeClient.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: identity + "_" + string(uuid.NewUUID())},
+			},
+			LeaseDuration:   leaderElection.LeaseDuration.Duration,
+			RenewDeadline:   leaderElection.RenewDeadline.Duration,
+			RetryPeriod:     leaderElection.RetryPeriod.Duration,
+			ReleaseOnCancel: true,
+			WatchDog:        watchdog,
+			Name:            leaderElection.ResourceName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				// The controller stops on the shutdown signal rather than
+				// on the cancellation of the election context, see below.
+				OnStartedLeading: func(context.Context) {
+					defer close(runDone)
+					run(ctx)
+				},
+				OnStoppedLeading: func() {
+					if ctx.Err() == nil {
+						logger.Error(nil, "Leader election lost")
+						klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+					}
+				},
+			},
+		})
+		if err != nil {
+			logger.Error(err, "Error setting up leader election")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		livenessChecks = append(livenessChecks, healthz.Checker{Name: "leader-election", Check: watchdog.Check})
+		readinessChecks = append(readinessChecks, healthz.Checker{Name: "leader-election", Check: func(*http.Request) error {
+			// Both the leader and the standby replicas that know who the
+			// leader is are ready.
+			if elector.IsLeader() || elector.GetLeader() != "" {
+				return nil
+			}
+			return fmt.Errorf("no leader observed yet")
+		}})
+	}
+
+	if addr := controllerConfig.MetricsBindAddress; addr != "0" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go serve(ctx, "metrics", addr, mux)
+	}
+	if addr := controllerConfig.HealthProbeBindAddress; addr != "0" {
+		mux := http.NewServeMux()
+		healthz.InstallHandler(mux, "/healthz", livenessChecks...)
+		healthz.InstallHandler(mux, "/readyz", readinessChecks...)
+		go serve(ctx, "health", addr, mux)
+	}
+
+	if coordinator != nil {
+		// The shard lease is kept until the workers have drained, so that
+		// no peer syncs the Books of this replica while it still writes to
+		// them.
+		coordinator.AddMembershipHandler(controller.Rebalance)
+		shardCtx, releaseShard := context.WithCancel(context.WithoutCancel(ctx))
+		shardDone := make(chan struct{})
+		go func() {
+			defer close(shardDone)
+			coordinator.Run(shardCtx)
+		}()
+		defer func() {
+			releaseShard()
+			<-shardDone
+		}()
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reload:
+				reloadConfig(ctx, configFile, controllerConfig, controller)
+			}
+		}
+	}()
+
+	if elector != nil {
+		// The lease is released only once the workers have drained, so that
+		// the next leader does not sync the same Books concurrently.
+		electionCtx, cancelElection := context.WithCancel(context.WithoutCancel(ctx))
+		go func() {
+			<-ctx.Done()
+			if elector.IsLeader() {
+				<-runDone
+			}
+			cancelElection()
+		}()
+		elector.Run(electionCtx)
+		return
+	}
+	run(ctx)
+}
+
+// reloadConfig reads the configuration file again and applies the fields
+// that are safe to change while the controller runs. Changes to the other
+// fields are reported and need a restart.
+func reloadConfig(ctx context.Context, configFile string, current *v1alpha1.ControllerConfiguration, c *controller.Controller) {
+	logger := klog.FromContext(ctx).WithValues("file", configFile)
+	if configFile == "" {
+		logger.Info("Ignoring reload request, no configuration file given")
+		return
+	}
+	updated, err := loadConfig(configFile, flag.CommandLine)
+	if err != nil {
+		logger.Error(err, "Error reloading configuration, keeping the current one")
+		return
+	}
+
+	c.SetRateLimit(updated.RateLimiter.QPS, updated.RateLimiter.Burst)
+	c.SetEnvoyDefaults(updated.Envoy)
+	c.SetMutualTLS(updated.MutualTLS)
+	logger.Info("Configuration reloaded")
+
+	// Compare what is left once the reloadable fields are aligned.
+	updated.RateLimiter.QPS = current.RateLimiter.QPS
+	updated.RateLimiter.Burst = current.RateLimiter.Burst
+	updated.Envoy = current.Envoy
+	updated.MutualTLS.CertificateValidity = current.MutualTLS.CertificateValidity
+	updated.MutualTLS.RenewBefore = current.MutualTLS.RenewBefore
+	if !equality.Semantic.DeepEqual(current, updated) {
+		logger.Info("Configuration changes other than rateLimiter.qps, rateLimiter.burst, envoy, mutualTLS.certificateValidity and mutualTLS.renewBefore need a restart to take effect")
+	}
+}
+
+// serve runs an HTTP server on addr until ctx is cancelled.
+func serve(ctx context.Context, name, addr string, handler http.Handler) {
+	logger := klog.FromContext(ctx).WithValues("server", name, "address", addr)
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	logger.Info("Starting HTTP server")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error(err, "HTTP server failed")
 	}
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	"github.com/shiponcs/simple-custom-controller/pkg/config"
+)
+
+// addConfigFlags binds the fields of cfg to command line flags. The current
+// values of cfg are used as the flag defaults.
+func addConfigFlags(fs *flag.FlagSet, cfg *v1alpha1.ControllerConfiguration) {
+	fs.StringVar(&cfg.ClientConnection.Kubeconfig, "kubeconfig", cfg.ClientConnection.Kubeconfig, "absolute path to the kubeconfig file")
+	fs.Var((*float32Value)(&cfg.ClientConnection.QPS), "kube-api-qps", "sustained rate of requests to the API server")
+	fs.Var((*int32Value)(&cfg.ClientConnection.Burst), "kube-api-burst", "requests allowed above kube-api-qps")
+
+	fs.Var((*int32Value)(&cfg.Workers), "workers", "number of Books synced concurrently")
+	fs.DurationVar(&cfg.ResyncPeriod.Duration, "resync-period", cfg.ResyncPeriod.Duration, "how often the informers replay every object")
+	fs.DurationVar(&cfg.ReconcileTimeout.Duration, "reconcile-timeout", cfg.ReconcileTimeout.Duration, "deadline of a single Book sync")
+	fs.DurationVar(&cfg.ShutdownGracePeriod.Duration, "shutdown-grace-period", cfg.ShutdownGracePeriod.Duration, "how long the in-flight syncs may take to finish on shutdown before they are cancelled")
+	fs.DurationVar(&cfg.RateLimiter.BaseDelay.Duration, "rate-limiter-base-delay", cfg.RateLimiter.BaseDelay.Duration, "backoff of a Book after its first failed sync")
+	fs.DurationVar(&cfg.RateLimiter.MaxDelay.Duration, "rate-limiter-max-delay", cfg.RateLimiter.MaxDelay.Duration, "maximum backoff of a failing Book")
+	fs.Var((*float32Value)(&cfg.RateLimiter.QPS), "rate-limiter-qps", "overall rate of Book retries")
+	fs.Var((*int32Value)(&cfg.RateLimiter.Burst), "rate-limiter-burst", "Book retries allowed above rate-limiter-qps")
+	fs.Var((*int32Value)(&cfg.RateLimiter.MaxRetries), "rate-limiter-max-retries", "retries of a failing Book before it is marked Degraded")
+	fs.Var((*stringSliceValue)(&cfg.Namespaces), "namespaces", "comma separated namespaces the controller is restricted to, every namespace when empty")
+	fs.StringVar(&cfg.BookSelector, "book-selector", cfg.BookSelector, "label selector restricting the controller to the matching Books")
+
+	fs.BoolVar(&cfg.LeaderElection.LeaderElect, "leader-elect", cfg.LeaderElection.LeaderElect, "elect a single active replica through a Lease")
+	fs.DurationVar(&cfg.LeaderElection.LeaseDuration.Duration, "leader-elect-lease-duration", cfg.LeaderElection.LeaseDuration.Duration, "how long standby replicas wait before taking over the lease")
+	fs.DurationVar(&cfg.LeaderElection.RenewDeadline.Duration, "leader-elect-renew-deadline", cfg.LeaderElection.RenewDeadline.Duration, "how long the leader retries renewing before giving up")
+	fs.DurationVar(&cfg.LeaderElection.RetryPeriod.Duration, "leader-elect-retry-period", cfg.LeaderElection.RetryPeriod.Duration, "wait between two attempts to acquire or renew the lease")
+	fs.StringVar(&cfg.LeaderElection.ResourceName, "leader-elect-resource-name", cfg.LeaderElection.ResourceName, "name of the leader election Lease")
+	fs.StringVar(&cfg.LeaderElection.ResourceNamespace, "leader-elect-resource-namespace", cfg.LeaderElection.ResourceNamespace, "namespace of the leader election Lease, defaults to the pod namespace")
+
+	fs.BoolVar(&cfg.Sharding.Enabled, "enable-sharding", cfg.Sharding.Enabled, "split the Books between all the running replicas of the controller")
+	fs.StringVar(&cfg.Sharding.Namespace, "shard-namespace", cfg.Sharding.Namespace, "namespace of the shard leases, defaults to the pod namespace")
+	fs.StringVar(&cfg.Sharding.Group, "shard-group", cfg.Sharding.Group, "name shared by the replicas that split the Books between them")
+	fs.DurationVar(&cfg.Sharding.LeaseDuration.Duration, "shard-lease-duration", cfg.Sharding.LeaseDuration.Duration, "how long a replica keeps its shard after its last lease renewal")
+	fs.DurationVar(&cfg.Sharding.RenewInterval.Duration, "shard-renew-interval", cfg.Sharding.RenewInterval.Duration, "how often the shard lease is renewed")
+
+	fs.StringVar(&cfg.MetricsBindAddress, "metrics-bind-address", cfg.MetricsBindAddress, "address the metrics endpoint binds to, set to 0 to disable it")
+	fs.StringVar(&cfg.HealthProbeBindAddress, "health-probe-bind-address", cfg.HealthProbeBindAddress, "address the /healthz and /readyz endpoints bind to, set to 0 to disable them")
+
+	fs.StringVar(&cfg.Envoy.Image, "envoy-image", cfg.Envoy.Image, "image of the envoy proxies")
+	fs.StringVar(&cfg.Envoy.ConfigFile, "envoy-config-file", cfg.Envoy.ConfigFile, "envoy bootstrap configuration shipped as is to the proxies instead of the one rendered from the Book spec")
+	fs.DurationVar(&cfg.Envoy.AdminScrapeInterval.Duration, "envoy-admin-scrape-interval", cfg.Envoy.AdminScrapeInterval.Duration, "how often the admin API of the envoy proxies is queried for the health of their upstreams")
+
+	fs.StringVar(&cfg.MutualTLS.CASecretName, "ca-secret-name", cfg.MutualTLS.CASecretName, "name of the Secret holding the certificate authority of the controller")
+	fs.StringVar(&cfg.MutualTLS.CASecretNamespace, "ca-secret-namespace", cfg.MutualTLS.CASecretNamespace, "namespace of the certificate authority Secret, defaults to the pod namespace")
+	fs.DurationVar(&cfg.MutualTLS.CertificateValidity.Duration, "certificate-validity", cfg.MutualTLS.CertificateValidity.Duration, "lifetime of the certificates issued for mutual TLS")
+	fs.DurationVar(&cfg.MutualTLS.RenewBefore.Duration, "certificate-renew-before", cfg.MutualTLS.RenewBefore.Duration, "how long before their expiry the mutual TLS certificates are replaced")
+}
+
+// loadConfig reads the configuration file and applies on top of it the flags
+// of cli that were set explicitly, so the command line always wins.
+func loadConfig(path string, cli *flag.FlagSet) (*v1alpha1.ControllerConfiguration, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	addConfigFlags(fs, cfg)
+	cli.Visit(func(f *flag.Flag) {
+		if err != nil || fs.Lookup(f.Name) == nil {
+			return
+		}
+		err = fs.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, config.Validate(cfg)
+}
+
+type float32Value float32
+
+func (v *float32Value) String() string {
+	return strconv.FormatFloat(float64(*v), 'g', -1, 32)
+}
+
+func (v *float32Value) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 32)
+	*v = float32Value(f)
+	return err
+}
+
+type int32Value int32
+
+func (v *int32Value) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func (v *int32Value) Set(s string) error {
+	i, err := strconv.ParseInt(s, 10, 32)
+	*v = int32Value(i)
+	return err
+}
+
+type stringSliceValue []string
+
+func (v *stringSliceValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringSliceValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+package config
+
+// GroupName is the group name of the controller configuration types
+const (
+	GroupName = "config.simplecustomcontroller.crd.com"
+)
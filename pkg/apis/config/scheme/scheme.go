@@ -0,0 +1,32 @@
+// Package scheme holds the scheme and the codecs of the controller
+// configuration. Every reader of the configuration goes through them, so
+// that the defaulting registered by the API versions applies the same way to
+// the file, the flags and the reloads.
+package scheme
+
+import (
+	"github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+var (
+	// Scheme knows every version of the controller configuration, with
+	// their defaulting functions.
+	Scheme = runtime.NewScheme()
+	// Codecs decodes the configuration files strictly: unknown and
+	// duplicate fields are rejected.
+	Codecs = serializer.NewCodecFactory(Scheme, serializer.EnableStrict)
+)
+
+func init() {
+	AddToScheme(Scheme)
+}
+
+// AddToScheme registers the versions of the controller configuration, with
+// their defaulting functions, to scheme.
+func AddToScheme(scheme *runtime.Scheme) {
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(scheme.SetVersionPriority(v1alpha1.SchemeGroupVersion))
+}
@@ -0,0 +1,113 @@
+package v1alpha1
+
+import (
+	"time"
+)
+
+// SetDefaults_ControllerConfiguration fills in the fields left empty with the
+// values the controller used before it could be configured.
+func SetDefaults_ControllerConfiguration(obj *ControllerConfiguration) {
+	if obj.Workers == 0 {
+		obj.Workers = 2
+	}
+	if obj.ResyncPeriod.Duration == 0 {
+		obj.ResyncPeriod.Duration = 30 * time.Second
+	}
+	if obj.ReconcileTimeout.Duration == 0 {
+		obj.ReconcileTimeout.Duration = time.Minute
+	}
+	if obj.ShutdownGracePeriod.Duration == 0 {
+		obj.ShutdownGracePeriod.Duration = 30 * time.Second
+	}
+	if obj.MetricsBindAddress == "" {
+		obj.MetricsBindAddress = ":8080"
+	}
+	if obj.HealthProbeBindAddress == "" {
+		obj.HealthProbeBindAddress = ":8081"
+	}
+}
+
+// SetDefaults_RateLimiterConfiguration sets the exponential backoff and the
+// token bucket of the workqueue.
+func SetDefaults_RateLimiterConfiguration(obj *RateLimiterConfiguration) {
+	if obj.BaseDelay.Duration == 0 {
+		obj.BaseDelay.Duration = 5 * time.Millisecond
+	}
+	if obj.MaxDelay.Duration == 0 {
+		obj.MaxDelay.Duration = 1000 * time.Second
+	}
+	if obj.QPS == 0 {
+		obj.QPS = 50
+	}
+	if obj.Burst == 0 {
+		obj.Burst = 300
+	}
+	if obj.MaxRetries == 0 {
+		obj.MaxRetries = 15
+	}
+}
+
+// SetDefaults_ClientConnectionConfiguration uses the client-go defaults.
+func SetDefaults_ClientConnectionConfiguration(obj *ClientConnectionConfiguration) {
+	if obj.QPS == 0 {
+		obj.QPS = 5
+	}
+	if obj.Burst == 0 {
+		obj.Burst = 10
+	}
+}
+
+// SetDefaults_LeaderElectionConfiguration uses the timings of the Kubernetes
+// controller-manager.
+func SetDefaults_LeaderElectionConfiguration(obj *LeaderElectionConfiguration) {
+	if obj.LeaseDuration.Duration == 0 {
+		obj.LeaseDuration.Duration = 15 * time.Second
+	}
+	if obj.RenewDeadline.Duration == 0 {
+		obj.RenewDeadline.Duration = 10 * time.Second
+	}
+	if obj.RetryPeriod.Duration == 0 {
+		obj.RetryPeriod.Duration = 2 * time.Second
+	}
+	if obj.ResourceName == "" {
+		obj.ResourceName = "simple-custom-controller"
+	}
+}
+
+// SetDefaults_ShardingConfiguration sets the shard group and its timings.
+func SetDefaults_ShardingConfiguration(obj *ShardingConfiguration) {
+	if obj.Group == "" {
+		obj.Group = "simple-custom-controller"
+	}
+	if obj.LeaseDuration.Duration == 0 {
+		obj.LeaseDuration.Duration = 15 * time.Second
+	}
+	if obj.RenewInterval.Duration == 0 {
+		obj.RenewInterval.Duration = 5 * time.Second
+	}
+}
+
+// SetDefaults_EnvoyConfiguration sets the envoy image and admin API scrape
+// interval.
+func SetDefaults_EnvoyConfiguration(obj *EnvoyConfiguration) {
+	if obj.Image == "" {
+		obj.Image = "envoyproxy/envoy:v1.32.3"
+	}
+	if obj.AdminScrapeInterval.Duration == 0 {
+		obj.AdminScrapeInterval.Duration = 30 * time.Second
+	}
+}
+
+// SetDefaults_MutualTLSConfiguration issues certificates valid for a day,
+// renewed a third of their lifetime before they expire.
+func SetDefaults_MutualTLSConfiguration(obj *MutualTLSConfiguration) {
+	if obj.CASecretName == "" {
+		obj.CASecretName = "simple-custom-controller-ca"
+	}
+	if obj.CertificateValidity.Duration == 0 {
+		obj.CertificateValidity.Duration = 24 * time.Hour
+	}
+	if obj.RenewBefore.Duration == 0 {
+		obj.RenewBefore.Duration = 8 * time.Hour
+	}
+}
@@ -0,0 +1,6 @@
+// +k8s:deepcopy-gen=package
+// +k8s:defaulter-gen=TypeMeta
+// +groupName=config.simplecustomcontroller.crd.com
+
+// Package v1alpha1 is the v1alpha1 version of the controller configuration.
+package v1alpha1
@@ -0,0 +1,146 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ControllerConfiguration holds the settings of the Book controller. It is
+// read from the file given with --config. Fields that are safe to change
+// while the controller runs are marked as reloadable; they are applied again
+// on SIGHUP.
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Workers is the number of Books synced concurrently.
+	Workers int32 `json:"workers,omitempty"`
+	// ResyncPeriod is how often the informers replay every object.
+	ResyncPeriod metav1.Duration `json:"resyncPeriod,omitempty"`
+	// ReconcileTimeout is the deadline of a single Book sync.
+	ReconcileTimeout metav1.Duration `json:"reconcileTimeout,omitempty"`
+	// ShutdownGracePeriod is how long the in-flight syncs are given to
+	// finish on shutdown before they are cancelled.
+	ShutdownGracePeriod metav1.Duration `json:"shutdownGracePeriod,omitempty"`
+	// RateLimiter configures the retries of the Book workqueue.
+	RateLimiter RateLimiterConfiguration `json:"rateLimiter,omitempty"`
+	// ClientConnection configures the connection to the API server.
+	ClientConnection ClientConnectionConfiguration `json:"clientConnection,omitempty"`
+	// Namespaces restricts the controller to the listed namespaces. Every
+	// namespace is watched when empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// BookSelector is a label selector restricting the controller to the
+	// matching Books. Every Book is handled when empty.
+	BookSelector string `json:"bookSelector,omitempty"`
+	// LeaderElection configures the election of the active replica.
+	LeaderElection LeaderElectionConfiguration `json:"leaderElection,omitempty"`
+	// Sharding configures the split of the Books between replicas.
+	Sharding ShardingConfiguration `json:"sharding,omitempty"`
+	// MetricsBindAddress is the address of the metrics endpoint, "0"
+	// disables it.
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+	// HealthProbeBindAddress is the address of the /healthz and /readyz
+	// endpoints, "0" disables them.
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+	// Envoy holds the defaults of the envoy proxies created for the Books.
+	// Reloadable.
+	Envoy EnvoyConfiguration `json:"envoy,omitempty"`
+	// MutualTLS configures the certificates issued to the Books using
+	// mutual TLS between envoy and the book-server.
+	MutualTLS MutualTLSConfiguration `json:"mutualTLS,omitempty"`
+}
+
+// RateLimiterConfiguration configures the retries of a workqueue. An item is
+// retried after the largest of its exponential backoff and the delay imposed
+// by the overall token bucket.
+type RateLimiterConfiguration struct {
+	// BaseDelay is the backoff after the first failure.
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay caps the exponential backoff.
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall rate of retries. Reloadable.
+	QPS float32 `json:"qps,omitempty"`
+	// Burst is the number of retries allowed above QPS. Reloadable.
+	Burst int32 `json:"burst,omitempty"`
+	// MaxRetries is the number of times a failing item is retried before
+	// the controller gives up on it until its next change or resync.
+	MaxRetries int32 `json:"maxRetries,omitempty"`
+}
+
+// ClientConnectionConfiguration configures the client talking to the API
+// server.
+type ClientConnectionConfiguration struct {
+	// Kubeconfig is the path of the kubeconfig file. The in-cluster config
+	// is used when empty.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// QPS is the sustained rate of requests to the API server.
+	QPS float32 `json:"qps,omitempty"`
+	// Burst is the number of requests allowed above QPS.
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// LeaderElectionConfiguration configures the election of the replica that
+// runs the workers.
+type LeaderElectionConfiguration struct {
+	// LeaderElect enables leader election.
+	LeaderElect bool `json:"leaderElect"`
+	// LeaseDuration is how long standby replicas wait before taking over a
+	// lease that is not renewed.
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewDeadline is how long the leader keeps retrying to renew before
+	// giving up the lease.
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	// RetryPeriod is the wait between two attempts to acquire or renew.
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+	// ResourceName is the name of the Lease.
+	ResourceName string `json:"resourceName,omitempty"`
+	// ResourceNamespace is the namespace of the Lease. The namespace of the
+	// pod is used when empty.
+	ResourceNamespace string `json:"resourceNamespace,omitempty"`
+}
+
+// ShardingConfiguration configures the split of the Books between several
+// replicas running at the same time.
+type ShardingConfiguration struct {
+	// Enabled turns sharding on.
+	Enabled bool `json:"enabled"`
+	// Group is the name shared by the replicas that split the Books.
+	Group string `json:"group,omitempty"`
+	// Namespace of the shard Leases. The namespace of the pod is used when
+	// empty.
+	Namespace string `json:"namespace,omitempty"`
+	// LeaseDuration is how long a replica keeps its shard after its last
+	// renewal.
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewInterval is how often the shard Lease is renewed.
+	RenewInterval metav1.Duration `json:"renewInterval,omitempty"`
+}
+
+// EnvoyConfiguration holds the defaults of the envoy proxies.
+type EnvoyConfiguration struct {
+	// Image is the envoy image.
+	Image string `json:"image,omitempty"`
+	// ConfigFile, when set, is shipped as is in the envoy ConfigMap of
+	// every Book instead of the configuration rendered from the Book spec.
+	ConfigFile string `json:"configFile,omitempty"`
+	// AdminScrapeInterval is how often the admin API of the envoy proxies is
+	// queried for the health of their upstreams.
+	AdminScrapeInterval metav1.Duration `json:"adminScrapeInterval,omitempty"`
+}
+
+// MutualTLSConfiguration configures the certificate authority of the
+// controller and the certificates it issues.
+type MutualTLSConfiguration struct {
+	// CASecretName is the name of the Secret holding the certificate
+	// authority. It is created on first use.
+	CASecretName string `json:"caSecretName,omitempty"`
+	// CASecretNamespace is the namespace of that Secret. The namespace of
+	// the pod is used when empty.
+	CASecretNamespace string `json:"caSecretNamespace,omitempty"`
+	// CertificateValidity is the lifetime of the issued certificates.
+	// Reloadable.
+	CertificateValidity metav1.Duration `json:"certificateValidity,omitempty"`
+	// RenewBefore is how long before their expiry the certificates are
+	// replaced. Reloadable.
+	RenewBefore metav1.Duration `json:"renewBefore,omitempty"`
+}
@@ -22,13 +22,588 @@ type BookSpec struct {
 	DeploymentName string           `json:"deploymentName"`
 	Replicas       *int32           `json:"replicas"`
 	Container      corev1.Container `json:"container"`
+	// PortProtocols sets the application protocol of the container ports.
+	// The ports not listed speak HTTP/1.1.
+	// +optional
+	// +listType=map
+	// +listMapKey=port
+	PortProtocols []PortProtocol `json:"portProtocols,omitempty"`
+	// Envoy configures the envoy proxy in front of the book-server.
+	// +optional
+	Envoy *EnvoySpec `json:"envoy,omitempty"`
+	// Idle scales the book-server down to zero when it receives no requests,
+	// and back up on the next request.
+	// +optional
+	Idle *IdleSpec `json:"idle,omitempty"`
+}
+
+// IdleSpec configures the scale to zero of an idle Book.
+type IdleSpec struct {
+	// Timeout is how long the book-server has to receive no request before
+	// it is scaled down.
+	Timeout metav1.Duration `json:"timeout"`
+	// WakeUpTimeout is how long envoy holds a request while the book-server
+	// scales back up, 60s by default.
+	// +optional
+	WakeUpTimeout *metav1.Duration `json:"wakeUpTimeout,omitempty"`
+}
+
+// EnvoySpec configures the envoy proxy of a Book.
+type EnvoySpec struct {
+	// Upstream configures how envoy balances and checks the book-server.
+	// +optional
+	Upstream *UpstreamSpec `json:"upstream,omitempty"`
+	// RateLimit limits the requests envoy lets through to the book-server.
+	// +optional
+	RateLimit *RateLimitSpec `json:"rateLimit,omitempty"`
+	// Auth makes envoy authenticate the requests.
+	// +optional
+	Auth *AuthSpec `json:"auth,omitempty"`
+	// HTTPPolicies are applied by envoy to every request and response.
+	// +optional
+	HTTPPolicies *HTTPPoliciesSpec `json:"httpPolicies,omitempty"`
+	// AccessLog makes envoy log every request.
+	// +optional
+	AccessLog *AccessLogSpec `json:"accessLog,omitempty"`
+	// GRPCWeb makes envoy translate the gRPC-Web requests of browsers to
+	// gRPC. It needs the grpc protocol on the book-server port.
+	// +optional
+	GRPCWeb bool `json:"grpcWeb,omitempty"`
+	// Mirror makes envoy shadow a share of the requests to another Book.
+	// +optional
+	Mirror *MirrorSpec `json:"mirror,omitempty"`
+}
+
+// MirrorSpec shadows requests to the book-server of another Book. The
+// responses of the mirror are discarded, so it never affects the clients.
+type MirrorSpec struct {
+	// Book is the name of the Book, in the same namespace, that receives
+	// the copies of the requests.
+	// +kubebuilder:validation:MinLength=1
+	Book string `json:"book"`
+	// Percent of the requests that are mirrored. Defaults to 100.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Percent *int32 `json:"percent,omitempty"`
+}
+
+// AppProtocol is the application protocol of a port.
+// +kubebuilder:validation:Enum=http;http2;grpc;websocket
+type AppProtocol string
+
+const (
+	// ProtocolHTTP is HTTP/1.1.
+	ProtocolHTTP AppProtocol = "http"
+	// ProtocolHTTP2 is HTTP/2 without TLS.
+	ProtocolHTTP2 AppProtocol = "http2"
+	// ProtocolGRPC is gRPC, over HTTP/2 without TLS.
+	ProtocolGRPC AppProtocol = "grpc"
+	// ProtocolWebSocket is HTTP/1.1 with WebSocket upgrades.
+	ProtocolWebSocket AppProtocol = "websocket"
+)
+
+// PortProtocol is the application protocol of a container port.
+type PortProtocol struct {
+	// Port is the number of the container port.
+	Port     int32       `json:"port"`
+	Protocol AppProtocol `json:"protocol"`
+}
+
+// LoadBalancingPolicy is the way envoy spreads the requests over the hosts
+// of the book-server.
+// +kubebuilder:validation:Enum=RoundRobin;LeastRequest;Random
+type LoadBalancingPolicy string
+
+const (
+	LoadBalancingRoundRobin   LoadBalancingPolicy = "RoundRobin"
+	LoadBalancingLeastRequest LoadBalancingPolicy = "LeastRequest"
+	LoadBalancingRandom       LoadBalancingPolicy = "Random"
+)
+
+// UpstreamSpec configures the book-server cluster of envoy.
+type UpstreamSpec struct {
+	// LoadBalancingPolicy defaults to RoundRobin.
+	// +optional
+	LoadBalancingPolicy LoadBalancingPolicy `json:"loadBalancingPolicy,omitempty"`
+	// HealthCheck enables the active HTTP health checking of the hosts. Its
+	// path also defaults the readinessProbe of the book-server container.
+	// +optional
+	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+	// OutlierDetection ejects the hosts returning consecutive 5xx.
+	// +optional
+	OutlierDetection *OutlierDetectionSpec `json:"outlierDetection,omitempty"`
+	// CircuitBreaker caps the connections and requests to the book-server.
+	// +optional
+	CircuitBreaker *CircuitBreakerSpec `json:"circuitBreaker,omitempty"`
+	// MutualTLS makes envoy and the book-server authenticate each other with
+	// certificates issued by the controller. The book-server has to serve
+	// TLS with the certificate mounted into its pods.
+	// +optional
+	MutualTLS bool `json:"mutualTLS,omitempty"`
+}
+
+// HealthCheckSpec configures an HTTP health check.
+type HealthCheckSpec struct {
+	// Path is the HTTP path checked on the book-server.
+	// +kubebuilder:validation:Pattern=`^/`
+	Path string `json:"path"`
+	// Interval between two checks of a host, 10s by default.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Timeout of a check, 1s by default.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// UnhealthyThreshold is the number of failed checks marking a host
+	// unhealthy, 3 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	UnhealthyThreshold *int32 `json:"unhealthyThreshold,omitempty"`
+	// HealthyThreshold is the number of passed checks marking a host
+	// healthy again, 1 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	HealthyThreshold *int32 `json:"healthyThreshold,omitempty"`
+}
+
+// OutlierDetectionSpec configures the passive health checking of the hosts.
+type OutlierDetectionSpec struct {
+	// Consecutive5xx is the number of 5xx in a row ejecting a host, 5 by
+	// default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Consecutive5xx *int32 `json:"consecutive5xx,omitempty"`
+	// Interval between two sweeps of the hosts, 10s by default.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// BaseEjectionTime is how long a host is ejected the first time, 30s by
+	// default. It grows with every ejection.
+	// +optional
+	BaseEjectionTime *metav1.Duration `json:"baseEjectionTime,omitempty"`
+	// MaxEjectionPercent caps the share of ejected hosts, 10 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxEjectionPercent *int32 `json:"maxEjectionPercent,omitempty"`
+}
+
+// CircuitBreakerSpec sets the thresholds of the book-server cluster. The
+// envoy defaults apply to the fields left empty.
+type CircuitBreakerSpec struct {
+	// MaxConnections is the maximum number of connections to the cluster.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+	// MaxPendingRequests is the maximum number of requests waiting for a
+	// connection.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxPendingRequests *int32 `json:"maxPendingRequests,omitempty"`
+	// MaxRequests is the maximum number of requests in flight.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxRequests *int32 `json:"maxRequests,omitempty"`
+	// MaxRetries is the maximum number of retries in flight.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
 }
 
 // BookStatus is the status for a Book resource
 type BookStatus struct {
 	AvailableReplicas int32 `json:"availableReplicas"`
+	// Shard is the identity of the controller replica that last synced the
+	// Book when sharding is enabled.
+	// +optional
+	Shard string `json:"shard,omitempty"`
+	// LastHandledReconcileAt is the value of the ReconcileAtAnnotation
+	// when the Book was last synced.
+	// +optional
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+	// Rollout describes the rollout of the book-server Deployment.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// PodIssues lists the problems of the book-server and envoy pods, like
+	// containers crash looping or failing to pull their image.
+	// +optional
+	// +kubebuilder:validation:MaxItems=10
+	PodIssues []PodIssue `json:"podIssues,omitempty"`
+	// Envoy reports the health of the upstreams of the envoy proxies, read
+	// from their admin API.
+	// +optional
+	Envoy *EnvoyStatus `json:"envoy,omitempty"`
+	// TLS reports the certificates issued for mutual TLS.
+	// +optional
+	TLS *TLSStatus `json:"tls,omitempty"`
+	// Conditions describe the outcome of the last syncs of the Book.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// RolloutState is the state of the rollout of the book-server Deployment.
+// +kubebuilder:validation:Enum=Progressing;Complete;Failed
+type RolloutState string
+
+const (
+	// RolloutProgressing means the Deployment is rolling out its current
+	// revision.
+	RolloutProgressing RolloutState = "Progressing"
+	// RolloutComplete means every replica runs the current revision and is
+	// available.
+	RolloutComplete RolloutState = "Complete"
+	// RolloutFailed means the rollout exceeded its progress deadline.
+	RolloutFailed RolloutState = "Failed"
+)
+
+// RolloutStatus is the status of the rollout of the book-server Deployment.
+type RolloutStatus struct {
+	State RolloutState `json:"state"`
+	// Revision is the revision of the Deployment being rolled out.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Image is the image of the book-server container being rolled out.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// UpdatedReplicas is the number of replicas running the current
+	// revision.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// Message explains the state.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PodIssue is a problem of a container, or of a pod that cannot be
+// scheduled.
+type PodIssue struct {
+	// Pod is the name of the pod.
+	Pod string `json:"pod"`
+	// Container is the name of the container, empty for an issue of the pod
+	// itself.
+	// +optional
+	Container string `json:"container,omitempty"`
+	// Reason is a short reason like CrashLoopBackOff, ImagePullBackOff,
+	// OOMKilled or Unschedulable.
+	Reason string `json:"reason"`
+	// RestartCount is the number of restarts of the container.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+	// Message is the message of the current state, or of the last
+	// termination of the container.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// TLSStatus is the state of the certificates of a Book.
+type TLSStatus struct {
+	// NotAfter is when the first of the certificates expires.
+	NotAfter metav1.Time `json:"notAfter"`
+	// RenewAt is when the certificates are replaced.
+	RenewAt metav1.Time `json:"renewAt"`
+}
+
+// EnvoyStatus is the state of the upstream clusters of the envoy proxies of
+// a Book.
+type EnvoyStatus struct {
+	// ScrapedPods is the number of envoy pods whose admin API answered.
+	ScrapedPods int32 `json:"scrapedPods"`
+	// Upstreams lists the upstream clusters, by name.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Upstreams []UpstreamStatus `json:"upstreams,omitempty"`
+	// RateLimitedRequests is the number of requests rejected by the local
+	// rate limits, summed over the envoy pods since they started.
+	// +optional
+	RateLimitedRequests int64 `json:"rateLimitedRequests,omitempty"`
+	// RateLimitedRate is the number of requests rejected per second by the
+	// local rate limits.
+	// +optional
+	RateLimitedRate string `json:"rateLimitedRate,omitempty"`
+}
+
+// UpstreamStatus is the state of an upstream cluster of envoy. Hosts are
+// counted as seen by the envoy pod that reports the fewest healthy ones;
+// rates are added up over all the envoy pods.
+type UpstreamStatus struct {
+	// Name is the name of the envoy cluster.
+	Name string `json:"name"`
+	// HealthyHosts is the number of hosts of the cluster that pass their
+	// health checks.
+	HealthyHosts int32 `json:"healthyHosts"`
+	// TotalHosts is the number of hosts of the cluster.
+	TotalHosts int32 `json:"totalHosts"`
+	// RequestRate is the number of requests per second sent to the cluster.
+	// +optional
+	RequestRate string `json:"requestRate,omitempty"`
+	// ErrorRate is the number of 5xx responses per second returned by the
+	// cluster.
+	// +optional
+	ErrorRate string `json:"errorRate,omitempty"`
+}
+
+// RateLimitSpec configures the local rate limiting of envoy. Every envoy pod
+// enforces the limits on its own.
+type RateLimitSpec struct {
+	// TokenBucket limits every request. No request is limited by default.
+	// +optional
+	TokenBucket *TokenBucket `json:"tokenBucket,omitempty"`
+	// Routes limit the requests whose path starts with a prefix, instead of
+	// TokenBucket. The first matching route applies.
+	// +optional
+	Routes []RouteRateLimit `json:"routes,omitempty"`
+	// Headers limit the requests carrying a header value, on top of the
+	// other limits. The fill interval of their token bucket must be a
+	// multiple of the one of TokenBucket, or of the route they go through.
+	// +optional
+	Headers []HeaderRateLimit `json:"headers,omitempty"`
+	// StatusCode is the status of the limited requests, 429 by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=400
+	// +kubebuilder:validation:Maximum=599
+	StatusCode *int32 `json:"statusCode,omitempty"`
+	// ResponseHeaders are added to the responses of the limited requests.
+	// +optional
+	ResponseHeaders []HTTPHeader `json:"responseHeaders,omitempty"`
+}
+
+// TokenBucket lets MaxTokens requests through at once, and TokensPerFill
+// more every FillInterval.
+type TokenBucket struct {
+	// +kubebuilder:validation:Minimum=1
+	MaxTokens int32 `json:"maxTokens"`
+	// TokensPerFill defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TokensPerFill *int32          `json:"tokensPerFill,omitempty"`
+	FillInterval  metav1.Duration `json:"fillInterval"`
 }
 
+// RouteRateLimit limits the requests of a path prefix.
+type RouteRateLimit struct {
+	// +kubebuilder:validation:Pattern=`^/`
+	PathPrefix  string      `json:"pathPrefix"`
+	TokenBucket TokenBucket `json:"tokenBucket"`
+}
+
+// HeaderRateLimit limits the requests whose header Name has the given
+// Value.
+type HeaderRateLimit struct {
+	Name        string      `json:"name"`
+	Value       string      `json:"value"`
+	TokenBucket TokenBucket `json:"tokenBucket"`
+}
+
+// AuthSpec configures the authentication of the requests by envoy.
+type AuthSpec struct {
+	// JWT requires a JSON Web Token signed by one of the providers.
+	// +optional
+	JWT *JWTSpec `json:"jwt,omitempty"`
+}
+
+// JWTSpec configures the validation of the JSON Web Tokens of the requests,
+// read from the Authorization bearer header.
+type JWTSpec struct {
+	// Providers are the accepted token issuers. A token of any of them is
+	// accepted.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	Providers []JWTProvider `json:"providers"`
+	// ExemptPathPrefixes are reachable without a token.
+	// +optional
+	ExemptPathPrefixes []string `json:"exemptPathPrefixes,omitempty"`
+}
+
+// JWTProvider is an issuer of JSON Web Tokens.
+type JWTProvider struct {
+	// Name identifies the provider. It is used in the names of the envoy
+	// volumes.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// Issuer is the expected iss claim.
+	Issuer string `json:"issuer"`
+	// Audiences are the accepted aud claims. Any audience is accepted when
+	// empty.
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+	// JWKS holds the public keys of the provider.
+	JWKS JWKSSource `json:"jwks"`
+}
+
+// JWKSSource is a JSON Web Key Set. Exactly one field must be set.
+// +kubebuilder:validation:MinProperties=1
+// +kubebuilder:validation:MaxProperties=1
+type JWKSSource struct {
+	// Inline is the key set itself.
+	// +optional
+	Inline string `json:"inline,omitempty"`
+	// ConfigMapKeyRef is a key of a ConfigMap of the namespace of the Book.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef is a key of a Secret of the namespace of the Book.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// HTTPPoliciesSpec configures the handling of the requests and responses by
+// envoy.
+type HTTPPoliciesSpec struct {
+	// CORS answers the preflight requests and adds the CORS headers to the
+	// responses.
+	// +optional
+	CORS *CORSPolicy `json:"cors,omitempty"`
+	// RequestHeaders changes the headers of the requests sent to the
+	// book-server.
+	// +optional
+	RequestHeaders *HeaderPolicy `json:"requestHeaders,omitempty"`
+	// ResponseHeaders changes the headers of the responses sent to the
+	// clients.
+	// +optional
+	ResponseHeaders *HeaderPolicy `json:"responseHeaders,omitempty"`
+	// Compression compresses the responses for the clients that accept it.
+	// +optional
+	Compression *CompressionPolicy `json:"compression,omitempty"`
+}
+
+// CORSPolicy is a Cross-Origin Resource Sharing policy.
+type CORSPolicy struct {
+	// AllowOrigins are the allowed origins, like https://example.com. "*"
+	// allows every origin.
+	// +kubebuilder:validation:MinItems=1
+	AllowOrigins []string `json:"allowOrigins"`
+	// AllowMethods are the allowed methods.
+	// +optional
+	AllowMethods []string `json:"allowMethods,omitempty"`
+	// AllowHeaders are the allowed request headers.
+	// +optional
+	AllowHeaders []string `json:"allowHeaders,omitempty"`
+	// ExposeHeaders are the response headers exposed to the clients.
+	// +optional
+	ExposeHeaders []string `json:"exposeHeaders,omitempty"`
+	// MaxAge is how long the clients may cache a preflight response.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// AllowCredentials lets the clients send credentials.
+	// +optional
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+}
+
+// HeaderPolicy adds and removes HTTP headers.
+type HeaderPolicy struct {
+	// Set adds the headers, replacing the existing values.
+	// +optional
+	Set []HTTPHeader `json:"set,omitempty"`
+	// Remove removes the headers.
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+}
+
+// CompressionAlgorithm is a content encoding.
+// +kubebuilder:validation:Enum=Gzip;Brotli
+type CompressionAlgorithm string
+
+const (
+	CompressionGzip   CompressionAlgorithm = "Gzip"
+	CompressionBrotli CompressionAlgorithm = "Brotli"
+)
+
+// CompressionPolicy configures the compression of the responses.
+type CompressionPolicy struct {
+	// Algorithms are offered in order of preference.
+	// +kubebuilder:validation:MinItems=1
+	Algorithms []CompressionAlgorithm `json:"algorithms"`
+	// MinContentLength is the size under which responses are left as they
+	// are, 30 bytes by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MinContentLength *int32 `json:"minContentLength,omitempty"`
+	// ContentTypes are the compressed content types. Envoy compresses the
+	// common text types by default.
+	// +optional
+	ContentTypes []string `json:"contentTypes,omitempty"`
+}
+
+// AccessLogFormat is the format of the access log entries.
+// +kubebuilder:validation:Enum=JSON;Text
+type AccessLogFormat string
+
+const (
+	AccessLogJSON AccessLogFormat = "JSON"
+	AccessLogText AccessLogFormat = "Text"
+)
+
+// AccessLogSink is where the access log entries are written.
+// +kubebuilder:validation:Enum=Stdout;File
+type AccessLogSink string
+
+const (
+	AccessLogStdout AccessLogSink = "Stdout"
+	AccessLogFile   AccessLogSink = "File"
+)
+
+// AccessLogSpec configures the access log of envoy.
+type AccessLogSpec struct {
+	// Format defaults to JSON.
+	// +optional
+	Format AccessLogFormat `json:"format,omitempty"`
+	// TextFormat is the envoy format string of the Text entries, like
+	// "[%START_TIME%] %REQ(:METHOD)% %RESPONSE_CODE%\n". The envoy default
+	// format is used when empty.
+	// +optional
+	TextFormat string `json:"textFormat,omitempty"`
+	// JSONFields maps the fields of the JSON entries to envoy command
+	// operators or to static values. A set of request fields is logged
+	// when empty. The name and namespace of the Book are always added.
+	// +optional
+	JSONFields map[string]string `json:"jsonFields,omitempty"`
+	// Sink defaults to Stdout.
+	// +optional
+	Sink AccessLogSink `json:"sink,omitempty"`
+	// Path is the file of the File sink, in the envoy container.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// MinStatusCode only logs the responses of at least this status.
+	// +optional
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:validation:Maximum=599
+	MinStatusCode *int32 `json:"minStatusCode,omitempty"`
+	// SamplePercent only logs this share of the requests.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	SamplePercent *int32 `json:"samplePercent,omitempty"`
+}
+
+// HTTPHeader is an HTTP header and its value.
+type HTTPHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ReconcileAtAnnotation requests a sync of the Book when its value, usually a
+// timestamp, changes. The value is copied to status.lastHandledReconcileAt
+// once the sync is done.
+const ReconcileAtAnnotation = "simplecustomcontroller.crd.com/reconcile-at"
+
+// ConditionDegraded is true when the Book could not be synced, either because
+// of an error that retrying does not fix or because the retries ran out.
+const ConditionDegraded = "Degraded"
+
+// ConditionEnvoyUpstreamHealthy is true when every host of every upstream
+// cluster of the envoy proxies is healthy.
+const ConditionEnvoyUpstreamHealthy = "EnvoyUpstreamHealthy"
+
+// ConditionIdle is true while the book-server of a Book with spec.idle is
+// scaled down to zero for lack of requests.
+const ConditionIdle = "Idle"
+
+// ConditionMirrorReady is true when the requests of a Book with
+// spec.envoy.mirror are mirrored to the target Book.
+const ConditionMirrorReady = "MirrorReady"
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // BookList is a list of Book resources
@@ -0,0 +1,200 @@
+// Package certs implements the small certificate authority issuing the
+// certificates envoy and the book-server authenticate each other with.
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// The keys of the Secrets holding a key pair, those of a kubernetes.io/tls
+// Secret.
+const (
+	CertKey = "tls.crt"
+	KeyKey  = "tls.key"
+	CAKey   = "ca.crt"
+)
+
+// caValidity is the lifetime of a new CA. The CA itself is not rotated.
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// clockSkew backdates the certificates so that hosts whose clock is slightly
+// behind accept them right away.
+const clockSkew = 5 * time.Minute
+
+// KeyPair is a certificate and its private key, PEM encoded.
+type KeyPair struct {
+	Cert []byte
+	Key  []byte
+}
+
+// CA is a certificate authority. Its clock decides the validity of the
+// certificates it issues and when they are due for renewal.
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	keyPair KeyPair
+	clock   clock.PassiveClock
+}
+
+// NewCA creates a self-signed CA.
+func NewCA(clock clock.PassiveClock, commonName string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	keyPair, err := encode(der, key)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCA(clock, keyPair)
+}
+
+// ParseCA loads the CA of keyPair, as returned by KeyPair.
+func ParseCA(clock clock.PassiveClock, keyPair KeyPair) (*CA, error) {
+	cert, err := parseCert(keyPair.Cert)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+	block, _ := pem.Decode(keyPair.Key)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return &CA{cert: cert, key: signer, keyPair: keyPair, clock: clock}, nil
+}
+
+// KeyPair returns the certificate and key of the CA, to be stored.
+func (ca *CA) KeyPair() KeyPair {
+	return ca.keyPair
+}
+
+// CertPEM returns the certificate of the CA, the trust anchor of the
+// certificates it issues.
+func (ca *CA) CertPEM() []byte {
+	return ca.keyPair.Cert
+}
+
+// Issue returns a new certificate for commonName and dnsNames, valid for
+// validity, usable for the given extended usages.
+func (ca *CA) Issue(commonName string, dnsNames []string, usages []x509.ExtKeyUsage, validity time.Duration) (KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return KeyPair{}, err
+	}
+	now := ca.clock.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return encode(der, key)
+}
+
+// NeedsRenewal reports whether the certificate certPEM should be replaced:
+// it cannot be parsed, was not issued by ca, does not cover dnsNames, or
+// expires within renewBefore.
+func (ca *CA) NeedsRenewal(certPEM []byte, dnsNames []string, renewBefore time.Duration) bool {
+	cert, err := parseCert(certPEM)
+	if err != nil || cert.CheckSignatureFrom(ca.cert) != nil {
+		return true
+	}
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return true
+		}
+	}
+	return !ca.clock.Now().Before(cert.NotAfter.Add(-renewBefore))
+}
+
+// NotAfter returns the expiry of the certificate certPEM.
+func NotAfter(certPEM []byte) (time.Time, error) {
+	cert, err := parseCert(certPEM)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+func parseCert(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func encode(der []byte, key crypto.Signer) (KeyPair, error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	var cert, keyPEM bytes.Buffer
+	if err := pem.Encode(&cert, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return KeyPair{}, err
+	}
+	if err := pem.Encode(&keyPEM, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}); err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{Cert: cert.Bytes(), Key: keyPEM.Bytes()}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	configscheme "github.com/shiponcs/simple-custom-controller/pkg/apis/config/scheme"
+	"github.com/shiponcs/simple-custom-controller/pkg/apis/config/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Default returns a configuration with every field set to its default. The
+// command line flags start from it.
+func Default() *v1alpha1.ControllerConfiguration {
+	cfg := &v1alpha1.ControllerConfiguration{}
+	configscheme.Scheme.Default(cfg)
+	return cfg
+}
+
+// Load reads a ControllerConfiguration from a file. Fields missing from the
+// file are defaulted by the decoder, with the same functions as Default.
+// Unknown fields are rejected.
+func Load(path string) (*v1alpha1.ControllerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, gvk, err := configscheme.Codecs.UniversalDecoder(v1alpha1.SchemeGroupVersion).Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	cfg, ok := obj.(*v1alpha1.ControllerConfiguration)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %s, expected a ControllerConfiguration", path, gvk)
+	}
+	return cfg, nil
+}
+
+// Validate checks that the configuration can be used to run the controller.
+func Validate(cfg *v1alpha1.ControllerConfiguration) error {
+	var errs field.ErrorList
+	if cfg.Workers < 1 {
+		errs = append(errs, field.Invalid(field.NewPath("workers"), cfg.Workers, "must be at least 1"))
+	}
+	if cfg.ResyncPeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("resyncPeriod"), cfg.ResyncPeriod.Duration.String(), "must not be negative"))
+	}
+	if cfg.ReconcileTimeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("reconcileTimeout"), cfg.ReconcileTimeout.Duration.String(), "must be positive"))
+	}
+	if cfg.ShutdownGracePeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("shutdownGracePeriod"), cfg.ShutdownGracePeriod.Duration.String(), "must not be negative"))
+	}
+
+	rateLimiter := field.NewPath("rateLimiter")
+	if cfg.RateLimiter.BaseDelay.Duration <= 0 {
+		errs = append(errs, field.Invalid(rateLimiter.Child("baseDelay"), cfg.RateLimiter.BaseDelay.Duration.String(), "must be positive"))
+	}
+	if cfg.RateLimiter.MaxDelay.Duration < cfg.RateLimiter.BaseDelay.Duration {
+		errs = append(errs, field.Invalid(rateLimiter.Child("maxDelay"), cfg.RateLimiter.MaxDelay.Duration.String(), "must not be lower than baseDelay"))
+	}
+	if cfg.RateLimiter.QPS <= 0 {
+		errs = append(errs, field.Invalid(rateLimiter.Child("qps"), cfg.RateLimiter.QPS, "must be positive"))
+	}
+	if cfg.RateLimiter.Burst < 1 {
+		errs = append(errs, field.Invalid(rateLimiter.Child("burst"), cfg.RateLimiter.Burst, "must be at least 1"))
+	}
+	if cfg.RateLimiter.MaxRetries < 1 {
+		errs = append(errs, field.Invalid(rateLimiter.Child("maxRetries"), cfg.RateLimiter.MaxRetries, "must be at least 1"))
+	}
+
+	clientConnection := field.NewPath("clientConnection")
+	if cfg.ClientConnection.QPS <= 0 {
+		errs = append(errs, field.Invalid(clientConnection.Child("qps"), cfg.ClientConnection.QPS, "must be positive"))
+	}
+	if cfg.ClientConnection.Burst < 1 {
+		errs = append(errs, field.Invalid(clientConnection.Child("burst"), cfg.ClientConnection.Burst, "must be at least 1"))
+	}
+
+	seen := sets.New[string]()
+	for i, namespace := range cfg.Namespaces {
+		path := field.NewPath("namespaces").Index(i)
+		for _, msg := range validation.ValidateNamespaceName(namespace, false) {
+			errs = append(errs, field.Invalid(path, namespace, msg))
+		}
+		if seen.Has(namespace) {
+			errs = append(errs, field.Duplicate(path, namespace))
+		}
+		seen.Insert(namespace)
+	}
+	if _, err := labels.Parse(cfg.BookSelector); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("bookSelector"), cfg.BookSelector, err.Error()))
+	}
+
+	leaderElection := field.NewPath("leaderElection")
+	if cfg.LeaderElection.LeaderElect {
+		if cfg.LeaderElection.LeaseDuration.Duration <= cfg.LeaderElection.RenewDeadline.Duration {
+			errs = append(errs, field.Invalid(leaderElection.Child("leaseDuration"), cfg.LeaderElection.LeaseDuration.Duration.String(), "must be greater than renewDeadline"))
+		}
+		if cfg.LeaderElection.RetryPeriod.Duration <= 0 {
+			errs = append(errs, field.Invalid(leaderElection.Child("retryPeriod"), cfg.LeaderElection.RetryPeriod.Duration.String(), "must be positive"))
+		}
+		if cfg.LeaderElection.ResourceName == "" {
+			errs = append(errs, field.Required(leaderElection.Child("resourceName"), ""))
+		}
+		if cfg.Sharding.Enabled {
+			errs = append(errs, field.Forbidden(leaderElection.Child("leaderElect"), "cannot be combined with sharding"))
+		}
+	}
+
+	sharding := field.NewPath("sharding")
+	if cfg.Sharding.Enabled && cfg.Sharding.RenewInterval.Duration >= cfg.Sharding.LeaseDuration.Duration {
+		errs = append(errs, field.Invalid(sharding.Child("renewInterval"), cfg.Sharding.RenewInterval.Duration.String(), "must be lower than leaseDuration"))
+	}
+
+	envoy := field.NewPath("envoy")
+	if cfg.Envoy.Image == "" {
+		errs = append(errs, field.Required(envoy.Child("image"), ""))
+	}
+	if cfg.Envoy.AdminScrapeInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(envoy.Child("adminScrapeInterval"), cfg.Envoy.AdminScrapeInterval.Duration.String(), "must be positive"))
+	}
+
+	mutualTLS := field.NewPath("mutualTLS")
+	if cfg.MutualTLS.CASecretName == "" {
+		errs = append(errs, field.Required(mutualTLS.Child("caSecretName"), ""))
+	}
+	if cfg.MutualTLS.RenewBefore.Duration <= 0 {
+		errs = append(errs, field.Invalid(mutualTLS.Child("renewBefore"), cfg.MutualTLS.RenewBefore.Duration.String(), "must be positive"))
+	}
+	if cfg.MutualTLS.CertificateValidity.Duration <= cfg.MutualTLS.RenewBefore.Duration {
+		errs = append(errs, field.Invalid(mutualTLS.Child("certificateValidity"), cfg.MutualTLS.CertificateValidity.Duration.String(), "must be greater than renewBefore"))
+	}
+	return errs.ToAggregate()
+}
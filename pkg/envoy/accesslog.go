@@ -0,0 +1,132 @@
+package envoy
+
+import (
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	stdoutAccessLogType = "type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog"
+	fileAccessLogType   = "type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog"
+)
+
+// defaultJSONFields are the fields of the JSON access log entries when the
+// Book does not list any.
+var defaultJSONFields = map[string]string{
+	"start_time":      "%START_TIME%",
+	"method":          "%REQ(:METHOD)%",
+	"path":            "%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%",
+	"protocol":        "%PROTOCOL%",
+	"response_code":   "%RESPONSE_CODE%",
+	"response_flags":  "%RESPONSE_FLAGS%",
+	"bytes_received":  "%BYTES_RECEIVED%",
+	"bytes_sent":      "%BYTES_SENT%",
+	"duration_ms":     "%DURATION%",
+	"upstream_host":   "%UPSTREAM_HOST%",
+	"x_forwarded_for": "%REQ(X-FORWARDED-FOR)%",
+	"user_agent":      "%REQ(USER-AGENT)%",
+	"request_id":      "%REQ(X-REQUEST-ID)%",
+}
+
+type accessLog struct {
+	Name        string           `json:"name"`
+	Filter      *accessLogFilter `json:"filter,omitempty"`
+	TypedConfig accessLogConfig  `json:"typed_config"`
+}
+
+type accessLogConfig struct {
+	Type      string     `json:"@type"`
+	Path      string     `json:"path,omitempty"`
+	LogFormat *logFormat `json:"log_format,omitempty"`
+}
+
+type logFormat struct {
+	JSONFormat       map[string]string `json:"json_format,omitempty"`
+	TextFormatSource *dataSource       `json:"text_format_source,omitempty"`
+}
+
+type accessLogFilter struct {
+	StatusCodeFilter *statusCodeFilter `json:"status_code_filter,omitempty"`
+	RuntimeFilter    *runtimeFilter    `json:"runtime_filter,omitempty"`
+	AndFilter        *andFilter        `json:"and_filter,omitempty"`
+}
+
+type statusCodeFilter struct {
+	Comparison comparisonFilter `json:"comparison"`
+}
+
+type comparisonFilter struct {
+	Op    string       `json:"op"`
+	Value runtimeValue `json:"value"`
+}
+
+type runtimeValue struct {
+	DefaultValue int32  `json:"default_value"`
+	RuntimeKey   string `json:"runtime_key"`
+}
+
+type runtimeFilter struct {
+	RuntimeKey     string            `json:"runtime_key"`
+	PercentSampled fractionalPercent `json:"percent_sampled"`
+}
+
+type andFilter struct {
+	Filters []accessLogFilter `json:"filters"`
+}
+
+// accessLogs returns the access log of the listener of the Book name in
+// namespace.
+func accessLogs(spec *bookv1.AccessLogSpec, name, namespace string) []accessLog {
+	config := accessLogConfig{Type: stdoutAccessLogType}
+	logger := "envoy.access_loggers.stdout"
+	if spec.Sink == bookv1.AccessLogFile {
+		logger = "envoy.access_loggers.file"
+		config = accessLogConfig{Type: fileAccessLogType, Path: spec.Path}
+		if config.Path == "" {
+			config.Path = "/dev/stdout"
+		}
+	}
+
+	if spec.Format == bookv1.AccessLogText {
+		if spec.TextFormat != "" {
+			config.LogFormat = &logFormat{TextFormatSource: &dataSource{InlineString: spec.TextFormat}}
+		}
+	} else {
+		fields := spec.JSONFields
+		if len(fields) == 0 {
+			fields = defaultJSONFields
+		}
+		format := map[string]string{}
+		for key, value := range fields {
+			format[key] = value
+		}
+		format["book"] = name
+		format["namespace"] = namespace
+		config.LogFormat = &logFormat{JSONFormat: format}
+	}
+
+	var filters []accessLogFilter
+	if spec.MinStatusCode != nil {
+		filters = append(filters, accessLogFilter{StatusCodeFilter: &statusCodeFilter{
+			Comparison: comparisonFilter{
+				Op:    "GE",
+				Value: runtimeValue{DefaultValue: *spec.MinStatusCode, RuntimeKey: "access_log.min_status_code"},
+			},
+		}})
+	}
+	if spec.SamplePercent != nil {
+		filters = append(filters, accessLogFilter{RuntimeFilter: &runtimeFilter{
+			RuntimeKey:     "access_log.sample_percent",
+			PercentSampled: fractionalPercent{Numerator: *spec.SamplePercent, Denominator: "HUNDRED"},
+		}})
+	}
+
+	log := accessLog{Name: logger, TypedConfig: config}
+	switch len(filters) {
+	case 0:
+	case 1:
+		log.Filter = &filters[0]
+	default:
+		log.Filter = &accessLogFilter{AndFilter: &andFilter{Filters: filters}}
+	}
+	return []accessLog{log}
+}
@@ -0,0 +1,159 @@
+package envoy
+
+import (
+	"testing"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestRenderAccessLog(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *bookv1.AccessLogSpec
+		// want is the access log of the listener, in YAML.
+		want string
+	}{
+		{
+			name: "JSON to stdout",
+			spec: &bookv1.AccessLogSpec{},
+			want: `
+- name: envoy.access_loggers.stdout
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+    log_format:
+      json_format:
+        book: book-api
+        namespace: default
+        start_time: '%START_TIME%'
+        method: '%REQ(:METHOD)%'
+        path: '%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%'
+        protocol: '%PROTOCOL%'
+        response_code: '%RESPONSE_CODE%'
+        response_flags: '%RESPONSE_FLAGS%'
+        bytes_received: '%BYTES_RECEIVED%'
+        bytes_sent: '%BYTES_SENT%'
+        duration_ms: '%DURATION%'
+        upstream_host: '%UPSTREAM_HOST%'
+        x_forwarded_for: '%REQ(X-FORWARDED-FOR)%'
+        user_agent: '%REQ(USER-AGENT)%'
+        request_id: '%REQ(X-REQUEST-ID)%'
+`,
+		},
+		{
+			// The fields of the Book replace the default ones, but the
+			// Book is always named.
+			name: "JSON fields",
+			spec: &bookv1.AccessLogSpec{
+				Format: bookv1.AccessLogJSON,
+				JSONFields: map[string]string{
+					"status":  "%RESPONSE_CODE%",
+					"book":    "overridden",
+					"service": "catalog",
+				},
+			},
+			want: `
+- name: envoy.access_loggers.stdout
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+    log_format:
+      json_format: {status: '%RESPONSE_CODE%', service: catalog, book: book-api, namespace: default}
+`,
+		},
+		{
+			name: "text to a file",
+			spec: &bookv1.AccessLogSpec{
+				Format:     bookv1.AccessLogText,
+				TextFormat: "[%START_TIME%] %REQ(:METHOD)% %RESPONSE_CODE%\n",
+				Sink:       bookv1.AccessLogFile,
+				Path:       "/var/log/envoy/access.log",
+			},
+			want: `
+- name: envoy.access_loggers.file
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+    path: /var/log/envoy/access.log
+    log_format:
+      text_format_source: {inline_string: "[%START_TIME%] %REQ(:METHOD)% %RESPONSE_CODE%\n"}
+`,
+		},
+		{
+			name: "default text to the default file",
+			spec: &bookv1.AccessLogSpec{Format: bookv1.AccessLogText, Sink: bookv1.AccessLogFile},
+			want: `
+- name: envoy.access_loggers.file
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.file.v3.FileAccessLog
+    path: /dev/stdout
+`,
+		},
+		{
+			name: "status code filter",
+			spec: &bookv1.AccessLogSpec{Format: bookv1.AccessLogText, MinStatusCode: ptr.To[int32](500)},
+			want: `
+- name: envoy.access_loggers.stdout
+  filter:
+    status_code_filter:
+      comparison:
+        op: GE
+        value: {default_value: 500, runtime_key: access_log.min_status_code}
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+`,
+		},
+		{
+			name: "sampled",
+			spec: &bookv1.AccessLogSpec{Format: bookv1.AccessLogText, SamplePercent: ptr.To[int32](0)},
+			want: `
+- name: envoy.access_loggers.stdout
+  filter:
+    runtime_filter:
+      runtime_key: access_log.sample_percent
+      percent_sampled: {numerator: 0, denominator: HUNDRED}
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+`,
+		},
+		{
+			name: "both filters",
+			spec: &bookv1.AccessLogSpec{Format: bookv1.AccessLogText, MinStatusCode: ptr.To[int32](400), SamplePercent: ptr.To[int32](10)},
+			want: `
+- name: envoy.access_loggers.stdout
+  filter:
+    and_filter:
+      filters:
+      - status_code_filter:
+          comparison:
+            op: GE
+            value: {default_value: 400, runtime_key: access_log.min_status_code}
+      - runtime_filter:
+          runtime_key: access_log.sample_percent
+          percent_sampled: {numerator: 10, denominator: HUNDRED}
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.access_loggers.stream.v3.StdoutAccessLog
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hcm := connectionManager(t, rendered(t, testConfig(&bookv1.EnvoySpec{AccessLog: tt.spec})))
+			assertYAML(t, "access_log", hcm["access_log"], tt.want)
+		})
+	}
+
+	hcm := connectionManager(t, rendered(t, testConfig(nil)))
+	if log, ok := hcm["access_log"]; ok {
+		t.Errorf("access_log without an access log spec = %v, want none", log)
+	}
+}
+
+// The Book fields are added to a copy: the spec, read from the informer
+// cache, must not change.
+func TestRenderAccessLogKeepsSpec(t *testing.T) {
+	fields := map[string]string{"status": "%RESPONSE_CODE%"}
+	rendered(t, testConfig(&bookv1.EnvoySpec{AccessLog: &bookv1.AccessLogSpec{JSONFields: fields}}))
+	rendered(t, testConfig(&bookv1.EnvoySpec{AccessLog: &bookv1.AccessLogSpec{}}))
+	if len(fields) != 1 || len(defaultJSONFields) != 13 {
+		t.Errorf("rendering changed the JSON fields: %d fields in the spec, %d default fields", len(fields), len(defaultJSONFields))
+	}
+}
@@ -0,0 +1,226 @@
+package envoy
+
+// The types below mirror the subset of the envoy v3 bootstrap API that the
+// controller renders. They marshal to the JSON names of the protobuf fields.
+
+const (
+	httpConnectionManagerType = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+	routerType                = "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"
+	localRateLimitType        = "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit"
+)
+
+type bootstrap struct {
+	StaticResources staticResources `json:"static_resources"`
+	Admin           admin           `json:"admin"`
+}
+
+type admin struct {
+	Address address `json:"address"`
+}
+
+type staticResources struct {
+	Listeners []listener `json:"listeners"`
+	Clusters  []cluster  `json:"clusters"`
+}
+
+type address struct {
+	SocketAddress socketAddress `json:"socket_address"`
+}
+
+type socketAddress struct {
+	Address   string `json:"address"`
+	PortValue int32  `json:"port_value"`
+}
+
+type listener struct {
+	Name         string        `json:"name"`
+	Address      address       `json:"address"`
+	FilterChains []filterChain `json:"filter_chains"`
+}
+
+type filterChain struct {
+	Filters []filter `json:"filters"`
+}
+
+// filter is a network or HTTP filter. TypedConfig carries its "@type".
+type filter struct {
+	Name        string      `json:"name"`
+	TypedConfig interface{} `json:"typed_config"`
+}
+
+// typed is the typed_config of a filter without settings.
+type typed struct {
+	Type string `json:"@type"`
+}
+
+type httpConnectionManager struct {
+	Type           string          `json:"@type"`
+	CodecType      string          `json:"codec_type"`
+	StatPrefix     string          `json:"stat_prefix"`
+	RouteConfig    routeConfig     `json:"route_config"`
+	HTTPFilters    []filter        `json:"http_filters"`
+	AccessLog      []accessLog     `json:"access_log,omitempty"`
+	UpgradeConfigs []upgradeConfig `json:"upgrade_configs,omitempty"`
+}
+
+type routeConfig struct {
+	Name         string        `json:"name"`
+	VirtualHosts []virtualHost `json:"virtual_hosts"`
+}
+
+type virtualHost struct {
+	Name                    string                 `json:"name"`
+	Domains                 []string               `json:"domains"`
+	Routes                  []route                `json:"routes"`
+	RequestHeadersToAdd     []headerValueOption    `json:"request_headers_to_add,omitempty"`
+	RequestHeadersToRemove  []string               `json:"request_headers_to_remove,omitempty"`
+	ResponseHeadersToAdd    []headerValueOption    `json:"response_headers_to_add,omitempty"`
+	ResponseHeadersToRemove []string               `json:"response_headers_to_remove,omitempty"`
+	TypedPerFilterConfig    map[string]interface{} `json:"typed_per_filter_config,omitempty"`
+}
+
+type route struct {
+	Match                routeMatch             `json:"match"`
+	Route                routeAction            `json:"route"`
+	TypedPerFilterConfig map[string]interface{} `json:"typed_per_filter_config,omitempty"`
+}
+
+type routeMatch struct {
+	Prefix string `json:"prefix"`
+}
+
+type routeAction struct {
+	Cluster               string                `json:"cluster"`
+	RateLimits            []rateLimit           `json:"rate_limits,omitempty"`
+	RequestMirrorPolicies []requestMirrorPolicy `json:"request_mirror_policies,omitempty"`
+	Timeout               string                `json:"timeout,omitempty"`
+	RetryPolicy           *retryPolicy          `json:"retry_policy,omitempty"`
+}
+
+type rateLimit struct {
+	Actions []rateLimitAction `json:"actions"`
+}
+
+type rateLimitAction struct {
+	RequestHeaders requestHeadersAction `json:"request_headers"`
+}
+
+type requestHeadersAction struct {
+	HeaderName    string `json:"header_name"`
+	DescriptorKey string `json:"descriptor_key"`
+	SkipIfAbsent  bool   `json:"skip_if_absent"`
+}
+
+type localRateLimit struct {
+	Type                 string                     `json:"@type"`
+	StatPrefix           string                     `json:"stat_prefix"`
+	Status               *httpStatus                `json:"status,omitempty"`
+	TokenBucket          *tokenBucket               `json:"token_bucket,omitempty"`
+	FilterEnabled        *runtimeFractionalPercent  `json:"filter_enabled,omitempty"`
+	FilterEnforced       *runtimeFractionalPercent  `json:"filter_enforced,omitempty"`
+	ResponseHeadersToAdd []headerValueOption        `json:"response_headers_to_add,omitempty"`
+	Descriptors          []localRateLimitDescriptor `json:"descriptors,omitempty"`
+}
+
+type httpStatus struct {
+	Code int32 `json:"code"`
+}
+
+type tokenBucket struct {
+	MaxTokens     int32  `json:"max_tokens"`
+	TokensPerFill int32  `json:"tokens_per_fill"`
+	FillInterval  string `json:"fill_interval"`
+}
+
+type runtimeFractionalPercent struct {
+	DefaultValue fractionalPercent `json:"default_value"`
+	RuntimeKey   string            `json:"runtime_key"`
+}
+
+type fractionalPercent struct {
+	Numerator   int32  `json:"numerator"`
+	Denominator string `json:"denominator"`
+}
+
+type headerValueOption struct {
+	Header       headerValue `json:"header"`
+	AppendAction string      `json:"append_action"`
+}
+
+type headerValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type localRateLimitDescriptor struct {
+	Entries     []descriptorEntry `json:"entries"`
+	TokenBucket tokenBucket       `json:"token_bucket"`
+}
+
+type descriptorEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type cluster struct {
+	Name             string            `json:"name"`
+	ConnectTimeout   string            `json:"connect_timeout"`
+	Type             string            `json:"type"`
+	LbPolicy         string            `json:"lb_policy"`
+	LoadAssignment   loadAssignment    `json:"load_assignment"`
+	HealthChecks     []healthCheck     `json:"health_checks,omitempty"`
+	OutlierDetection *outlierDetection `json:"outlier_detection,omitempty"`
+	CircuitBreakers  *circuitBreakers  `json:"circuit_breakers,omitempty"`
+	TransportSocket  *transportSocket  `json:"transport_socket,omitempty"`
+	// TypedExtensionProtocolOptions holds the protocol of the hosts.
+	TypedExtensionProtocolOptions map[string]interface{} `json:"typed_extension_protocol_options,omitempty"`
+}
+
+type loadAssignment struct {
+	ClusterName string                `json:"cluster_name"`
+	Endpoints   []localityLbEndpoints `json:"endpoints"`
+}
+
+type localityLbEndpoints struct {
+	LbEndpoints []lbEndpoint `json:"lb_endpoints"`
+	Priority    int32        `json:"priority,omitempty"`
+}
+
+type lbEndpoint struct {
+	Endpoint endpoint `json:"endpoint"`
+}
+
+type endpoint struct {
+	Address address `json:"address"`
+}
+
+type healthCheck struct {
+	Timeout            string          `json:"timeout"`
+	Interval           string          `json:"interval"`
+	UnhealthyThreshold int32           `json:"unhealthy_threshold"`
+	HealthyThreshold   int32           `json:"healthy_threshold"`
+	HTTPHealthCheck    httpHealthCheck `json:"http_health_check"`
+}
+
+type httpHealthCheck struct {
+	Path            string `json:"path"`
+	CodecClientType string `json:"codec_client_type,omitempty"`
+}
+
+type outlierDetection struct {
+	Consecutive5xx     int32  `json:"consecutive_5xx"`
+	Interval           string `json:"interval"`
+	BaseEjectionTime   string `json:"base_ejection_time"`
+	MaxEjectionPercent int32  `json:"max_ejection_percent"`
+}
+
+type circuitBreakers struct {
+	Thresholds []thresholds `json:"thresholds"`
+}
+
+type thresholds struct {
+	MaxConnections     *int32 `json:"max_connections,omitempty"`
+	MaxPendingRequests *int32 `json:"max_pending_requests,omitempty"`
+	MaxRequests        *int32 `json:"max_requests,omitempty"`
+	MaxRetries         *int32 `json:"max_retries,omitempty"`
+}
@@ -0,0 +1,90 @@
+package envoy
+
+import (
+	"path"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	jwtAuthnFilter = "envoy.filters.http.jwt_authn"
+	jwtAuthnType   = "type.googleapis.com/envoy.extensions.filters.http.jwt_authn.v3.JwtAuthentication"
+
+	// JWKSDir is where the key sets of the JWT providers are mounted in the
+	// envoy container, one directory per provider.
+	JWKSDir = "/etc/envoy/jwks"
+	// JWKSFileName is the name of the key set file of a provider.
+	JWKSFileName = "jwks.json"
+)
+
+type jwtAuthentication struct {
+	Type      string                 `json:"@type"`
+	Providers map[string]jwtProvider `json:"providers"`
+	Rules     []jwtRule              `json:"rules"`
+}
+
+type jwtProvider struct {
+	Issuer    string     `json:"issuer"`
+	Audiences []string   `json:"audiences,omitempty"`
+	LocalJwks dataSource `json:"local_jwks"`
+}
+
+type dataSource struct {
+	Filename     string `json:"filename,omitempty"`
+	InlineString string `json:"inline_string,omitempty"`
+}
+
+type jwtRule struct {
+	Match    routeMatch      `json:"match"`
+	Requires *jwtRequirement `json:"requires,omitempty"`
+}
+
+type jwtRequirement struct {
+	ProviderName string              `json:"provider_name,omitempty"`
+	RequiresAny  *jwtRequirementList `json:"requires_any,omitempty"`
+}
+
+type jwtRequirementList struct {
+	Requirements []jwtRequirement `json:"requirements"`
+}
+
+// JWKSFile returns the path of the key set of a provider read from a
+// ConfigMap or a Secret.
+func JWKSFile(provider string) string {
+	return path.Join(JWKSDir, provider, JWKSFileName)
+}
+
+// jwtFilter returns the HTTP filter checking the tokens of spec. The exempt
+// paths come first, as the first matching rule applies.
+func jwtFilter(spec *bookv1.JWTSpec) filter {
+	config := jwtAuthentication{
+		Type:      jwtAuthnType,
+		Providers: map[string]jwtProvider{},
+	}
+	requirement := &jwtRequirement{}
+	for _, provider := range spec.Providers {
+		source := dataSource{Filename: JWKSFile(provider.Name)}
+		if provider.JWKS.Inline != "" {
+			source = dataSource{InlineString: provider.JWKS.Inline}
+		}
+		config.Providers[provider.Name] = jwtProvider{
+			Issuer:    provider.Issuer,
+			Audiences: provider.Audiences,
+			LocalJwks: source,
+		}
+		if len(spec.Providers) == 1 {
+			requirement.ProviderName = provider.Name
+			continue
+		}
+		if requirement.RequiresAny == nil {
+			requirement.RequiresAny = &jwtRequirementList{}
+		}
+		requirement.RequiresAny.Requirements = append(requirement.RequiresAny.Requirements, jwtRequirement{ProviderName: provider.Name})
+	}
+
+	for _, prefix := range spec.ExemptPathPrefixes {
+		config.Rules = append(config.Rules, jwtRule{Match: routeMatch{Prefix: prefix}})
+	}
+	config.Rules = append(config.Rules, jwtRule{Match: routeMatch{Prefix: "/"}, Requires: requirement})
+	return filter{Name: jwtAuthnFilter, TypedConfig: config}
+}
@@ -0,0 +1,63 @@
+package envoy
+
+import (
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+// MirrorCluster is the name of the envoy cluster requests are mirrored to.
+const MirrorCluster = "mirror"
+
+// Mirror is the book-server requests are shadowed to.
+type Mirror struct {
+	// Host and Port address the Service of the book-server of the mirror.
+	Host string
+	Port int32
+	// Protocol is the protocol of that port, HTTP/1.1 when empty.
+	Protocol bookv1.AppProtocol
+	// TLS is set when the mirror requires mutual TLS. Envoy presents the
+	// certificate of its own Book, issued by the same CA.
+	TLS bool
+	// Percent of the requests that are mirrored.
+	Percent int32
+}
+
+type requestMirrorPolicy struct {
+	Cluster         string                   `json:"cluster"`
+	RuntimeFraction runtimeFractionalPercent `json:"runtime_fraction"`
+}
+
+// withMirror makes r shadow its requests to the mirror cluster.
+func withMirror(r route, mirror *Mirror) route {
+	r.Route.RequestMirrorPolicies = []requestMirrorPolicy{{
+		Cluster: MirrorCluster,
+		RuntimeFraction: runtimeFractionalPercent{
+			DefaultValue: fractionalPercent{Numerator: mirror.Percent, Denominator: "HUNDRED"},
+			RuntimeKey:   "mirror.percent",
+		},
+	}}
+	return r
+}
+
+// mirrorCluster renders the cluster of the mirror. It is not health checked:
+// failed copies of the requests are dropped anyway.
+func mirrorCluster(mirror *Mirror) cluster {
+	c := cluster{
+		Name:                          MirrorCluster,
+		TypedExtensionProtocolOptions: protocolOptions(mirror.Protocol),
+		ConnectTimeout:                duration(upstreamConnectTimeout),
+		Type:                          "STRICT_DNS",
+		LbPolicy:                      "ROUND_ROBIN",
+		LoadAssignment: loadAssignment{
+			ClusterName: MirrorCluster,
+			Endpoints: []localityLbEndpoints{{
+				LbEndpoints: []lbEndpoint{{
+					Endpoint: endpoint{Address: socketAddressOf(mirror.Host, mirror.Port)},
+				}},
+			}},
+		},
+	}
+	if mirror.TLS {
+		c.TransportSocket = upstreamTLS(mirror.Host, isHTTP2(mirror.Protocol))
+	}
+	return c
+}
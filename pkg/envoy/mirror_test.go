@@ -0,0 +1,110 @@
+package envoy
+
+import (
+	"testing"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"k8s.io/utils/ptr"
+)
+
+const mirrorPolicy = `
+- cluster: mirror
+  runtime_fraction:
+    default_value: {numerator: 25, denominator: HUNDRED}
+    runtime_key: mirror.percent
+`
+
+func TestRenderMirror(t *testing.T) {
+	tests := []struct {
+		name   string
+		mirror *Mirror
+		// wantCluster are fields of the mirror cluster, in YAML.
+		wantCluster string
+	}{
+		{
+			name:   "HTTP/1.1",
+			mirror: &Mirror{Host: "book-shadow.default.svc", Port: 9090, Percent: 25},
+			wantCluster: http1Options + `
+type: STRICT_DNS
+health_checks: null
+outlier_detection: null
+transport_socket: null
+load_assignment:
+  cluster_name: mirror
+  endpoints:
+  - lb_endpoints:
+    - endpoint:
+        address:
+          socket_address: {address: book-shadow.default.svc, port_value: 9090}
+`,
+		},
+		{
+			name:   "gRPC with mutual TLS",
+			mirror: &Mirror{Host: "book-shadow.default.svc", Port: 9090, Protocol: bookv1.ProtocolGRPC, TLS: true, Percent: 25},
+			wantCluster: http2Options + `
+transport_socket:
+  name: envoy.transport_sockets.tls
+  typed_config:
+    '@type': type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+    sni: book-shadow.default.svc
+    common_tls_context:
+      alpn_protocols: [h2]
+      tls_certificates:
+      - certificate_chain: {filename: /etc/envoy/tls/tls.crt}
+        private_key: {filename: /etc/envoy/tls/tls.key}
+      validation_context:
+        trusted_ca: {filename: /etc/envoy/tls/ca.crt}
+        match_typed_subject_alt_names:
+        - san_type: DNS
+          matcher: {exact: book-shadow.default.svc}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(nil)
+			config.Mirror = tt.mirror
+			bootstrap := rendered(t, config)
+			assertFields(t, clusterNamed(t, bootstrap, MirrorCluster), tt.wantCluster)
+			assertYAML(t, "request_mirror_policies", dig(t, routes(t, bootstrap), 0, "route", "request_mirror_policies"), mirrorPolicy)
+			// The book-server cluster is left as it is.
+			if tls := clusterNamed(t, bootstrap, UpstreamCluster)["transport_socket"]; tls != nil {
+				t.Errorf("book-server cluster transport_socket = %v, want none", tls)
+			}
+		})
+	}
+}
+
+func TestRenderNoMirror(t *testing.T) {
+	bootstrap := rendered(t, testConfig(nil))
+	if clusters := dig(t, bootstrap, "static_resources", "clusters").([]interface{}); len(clusters) != 1 {
+		t.Errorf("%d clusters rendered, want only the book-server", len(clusters))
+	}
+	if policies := dig(t, routes(t, bootstrap), 0, "route", "request_mirror_policies"); policies != nil {
+		t.Errorf("request_mirror_policies = %v, want none", policies)
+	}
+}
+
+// Every route mirrors, including those the rate limits add, and the mirror
+// is kept when the book-server may be woken up.
+func TestRenderMirrorEveryRoute(t *testing.T) {
+	config := testConfig(&bookv1.EnvoySpec{RateLimit: &bookv1.RateLimitSpec{
+		TokenBucket: ptr.To(bucket(100, time.Second)),
+		Routes:      []bookv1.RouteRateLimit{{PathPrefix: "/books/search", TokenBucket: bucket(5, time.Second)}},
+	}})
+	config.Mirror = &Mirror{Host: "book-shadow.default.svc", Port: 9090, Percent: 25}
+	config.FallbackHost = "book-api.default.svc"
+	config.WakeUpTimeout = time.Minute
+
+	rs := routes(t, rendered(t, config))
+	if len(rs) != 2 {
+		t.Fatalf("%d routes rendered, want 2", len(rs))
+	}
+	for i := range rs {
+		assertYAML(t, "request_mirror_policies", dig(t, rs, i, "route", "request_mirror_policies"), mirrorPolicy)
+		if policy := dig(t, rs, i, "route", "retry_policy"); policy == nil {
+			t.Errorf("route %d has no wake up retry policy", i)
+		}
+	}
+}
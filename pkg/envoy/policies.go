@@ -0,0 +1,134 @@
+package envoy
+
+import (
+	"strconv"
+	"strings"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	corsFilter       = "envoy.filters.http.cors"
+	corsType         = "type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors"
+	corsPolicyType   = "type.googleapis.com/envoy.extensions.filters.http.cors.v3.CorsPolicy"
+	compressorFilter = "envoy.filters.http.compressor"
+	compressorType   = "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor"
+	gzipType         = "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip"
+	brotliType       = "type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli"
+)
+
+type corsPolicy struct {
+	Type                   string          `json:"@type"`
+	AllowOriginStringMatch []stringMatcher `json:"allow_origin_string_match"`
+	AllowMethods           string          `json:"allow_methods,omitempty"`
+	AllowHeaders           string          `json:"allow_headers,omitempty"`
+	ExposeHeaders          string          `json:"expose_headers,omitempty"`
+	MaxAge                 string          `json:"max_age,omitempty"`
+	AllowCredentials       bool            `json:"allow_credentials,omitempty"`
+}
+
+type stringMatcher struct {
+	Exact     string      `json:"exact,omitempty"`
+	SafeRegex *regexMatch `json:"safe_regex,omitempty"`
+}
+
+type regexMatch struct {
+	Regex string `json:"regex"`
+}
+
+type compressor struct {
+	Type                    string                  `json:"@type"`
+	ResponseDirectionConfig responseDirectionConfig `json:"response_direction_config"`
+	CompressorLibrary       typedExtension          `json:"compressor_library"`
+}
+
+type responseDirectionConfig struct {
+	CommonConfig commonDirectionConfig `json:"common_config"`
+}
+
+type commonDirectionConfig struct {
+	MinContentLength *int32   `json:"min_content_length,omitempty"`
+	ContentType      []string `json:"content_type,omitempty"`
+}
+
+type typedExtension struct {
+	Name        string `json:"name"`
+	TypedConfig typed  `json:"typed_config"`
+}
+
+// policyFilters returns the HTTP filters the policies need. CORS comes
+// first so that the preflight requests are answered before any check.
+func policyFilters(spec *bookv1.HTTPPoliciesSpec) (cors, compression []filter) {
+	if spec.CORS != nil {
+		cors = append(cors, filter{Name: corsFilter, TypedConfig: typed{Type: corsType}})
+	}
+	if spec.Compression == nil {
+		return cors, nil
+	}
+	for _, algorithm := range spec.Compression.Algorithms {
+		library := typedExtension{Name: "gzip", TypedConfig: typed{Type: gzipType}}
+		if algorithm == bookv1.CompressionBrotli {
+			library = typedExtension{Name: "brotli", TypedConfig: typed{Type: brotliType}}
+		}
+		compression = append(compression, filter{
+			Name: compressorFilter,
+			TypedConfig: compressor{
+				Type: compressorType,
+				ResponseDirectionConfig: responseDirectionConfig{CommonConfig: commonDirectionConfig{
+					MinContentLength: spec.Compression.MinContentLength,
+					ContentType:      spec.Compression.ContentTypes,
+				}},
+				CompressorLibrary: library,
+			},
+		})
+	}
+	return cors, compression
+}
+
+// withPolicies sets the CORS policy and the header changes of spec on vhost.
+func withPolicies(vhost virtualHost, spec *bookv1.HTTPPoliciesSpec) virtualHost {
+	if cors := spec.CORS; cors != nil {
+		policy := corsPolicy{
+			Type:             corsPolicyType,
+			AllowMethods:     strings.Join(cors.AllowMethods, ","),
+			AllowHeaders:     strings.Join(cors.AllowHeaders, ","),
+			ExposeHeaders:    strings.Join(cors.ExposeHeaders, ","),
+			AllowCredentials: cors.AllowCredentials,
+		}
+		for _, origin := range cors.AllowOrigins {
+			if origin == "*" {
+				policy.AllowOriginStringMatch = append(policy.AllowOriginStringMatch, stringMatcher{SafeRegex: &regexMatch{Regex: ".*"}})
+				continue
+			}
+			policy.AllowOriginStringMatch = append(policy.AllowOriginStringMatch, stringMatcher{Exact: origin})
+		}
+		if cors.MaxAge != nil {
+			policy.MaxAge = strconv.FormatInt(int64(cors.MaxAge.Seconds()), 10)
+		}
+		if vhost.TypedPerFilterConfig == nil {
+			vhost.TypedPerFilterConfig = map[string]interface{}{}
+		}
+		vhost.TypedPerFilterConfig[corsFilter] = policy
+	}
+	if headers := spec.RequestHeaders; headers != nil {
+		vhost.RequestHeadersToAdd = setHeaders(headers.Set)
+		vhost.RequestHeadersToRemove = headers.Remove
+	}
+	if headers := spec.ResponseHeaders; headers != nil {
+		vhost.ResponseHeadersToAdd = setHeaders(headers.Set)
+		vhost.ResponseHeadersToRemove = headers.Remove
+	}
+	return vhost
+}
+
+// setHeaders returns the options replacing the values of headers.
+func setHeaders(headers []bookv1.HTTPHeader) []headerValueOption {
+	var options []headerValueOption
+	for _, header := range headers {
+		options = append(options, headerValueOption{
+			Header:       headerValue{Key: header.Name, Value: header.Value},
+			AppendAction: "OVERWRITE_IF_EXISTS_OR_ADD",
+		})
+	}
+	return options
+}
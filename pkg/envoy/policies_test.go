@@ -0,0 +1,171 @@
+package envoy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestRenderHTTPPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies *bookv1.HTTPPoliciesSpec
+		// wantFilters are the HTTP filters, in order.
+		wantFilters []string
+		// wantVirtualHost are fields of the virtual host, in YAML.
+		wantVirtualHost string
+		// wantCompressors are the configurations of the compressor
+		// filters, in YAML.
+		wantCompressors string
+	}{
+		{
+			name: "CORS",
+			policies: &bookv1.HTTPPoliciesSpec{CORS: &bookv1.CORSPolicy{
+				AllowOrigins:     []string{"https://example.com", "*"},
+				AllowMethods:     []string{"GET", "POST"},
+				AllowHeaders:     []string{"Authorization", "Content-Type"},
+				ExposeHeaders:    []string{"X-Request-Id"},
+				MaxAge:           &metav1.Duration{Duration: 10 * time.Minute},
+				AllowCredentials: true,
+			}},
+			wantFilters: []string{corsFilter, "envoy.filters.http.router"},
+			wantVirtualHost: `
+typed_per_filter_config:
+  envoy.filters.http.cors:
+    '@type': type.googleapis.com/envoy.extensions.filters.http.cors.v3.CorsPolicy
+    allow_origin_string_match:
+    - exact: https://example.com
+    - safe_regex: {regex: .*}
+    allow_methods: GET,POST
+    allow_headers: Authorization,Content-Type
+    expose_headers: X-Request-Id
+    max_age: "600"
+    allow_credentials: true
+request_headers_to_add: null
+response_headers_to_add: null
+`,
+		},
+		{
+			name: "CORS defaults",
+			policies: &bookv1.HTTPPoliciesSpec{CORS: &bookv1.CORSPolicy{
+				AllowOrigins: []string{"https://example.com"},
+			}},
+			wantFilters: []string{corsFilter, "envoy.filters.http.router"},
+			wantVirtualHost: `
+typed_per_filter_config:
+  envoy.filters.http.cors:
+    '@type': type.googleapis.com/envoy.extensions.filters.http.cors.v3.CorsPolicy
+    allow_origin_string_match:
+    - exact: https://example.com
+`,
+		},
+		{
+			name: "headers",
+			policies: &bookv1.HTTPPoliciesSpec{
+				RequestHeaders: &bookv1.HeaderPolicy{
+					Set:    []bookv1.HTTPHeader{{Name: "X-Forwarded-Proto", Value: "https"}},
+					Remove: []string{"X-Debug"},
+				},
+				ResponseHeaders: &bookv1.HeaderPolicy{
+					Set:    []bookv1.HTTPHeader{{Name: "Strict-Transport-Security", Value: "max-age=31536000"}},
+					Remove: []string{"Server", "X-Powered-By"},
+				},
+			},
+			wantFilters: []string{"envoy.filters.http.router"},
+			wantVirtualHost: `
+typed_per_filter_config: null
+request_headers_to_add:
+- header: {key: X-Forwarded-Proto, value: https}
+  append_action: OVERWRITE_IF_EXISTS_OR_ADD
+request_headers_to_remove: [X-Debug]
+response_headers_to_add:
+- header: {key: Strict-Transport-Security, value: max-age=31536000}
+  append_action: OVERWRITE_IF_EXISTS_OR_ADD
+response_headers_to_remove: [Server, X-Powered-By]
+`,
+		},
+		{
+			name: "compression",
+			policies: &bookv1.HTTPPoliciesSpec{Compression: &bookv1.CompressionPolicy{
+				Algorithms:       []bookv1.CompressionAlgorithm{bookv1.CompressionBrotli, bookv1.CompressionGzip},
+				MinContentLength: ptr.To[int32](1024),
+				ContentTypes:     []string{"application/json"},
+			}},
+			wantFilters: []string{compressorFilter, compressorFilter, "envoy.filters.http.router"},
+			wantCompressors: `
+- '@type': type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor
+  response_direction_config:
+    common_config: {min_content_length: 1024, content_type: [application/json]}
+  compressor_library:
+    name: brotli
+    typed_config: {'@type': type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli}
+- '@type': type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor
+  response_direction_config:
+    common_config: {min_content_length: 1024, content_type: [application/json]}
+  compressor_library:
+    name: gzip
+    typed_config: {'@type': type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip}
+`,
+		},
+		{
+			name: "compression defaults",
+			policies: &bookv1.HTTPPoliciesSpec{Compression: &bookv1.CompressionPolicy{
+				Algorithms: []bookv1.CompressionAlgorithm{bookv1.CompressionGzip},
+			}},
+			wantFilters: []string{compressorFilter, "envoy.filters.http.router"},
+			wantCompressors: `
+- '@type': type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor
+  response_direction_config:
+    common_config: {}
+  compressor_library:
+    name: gzip
+    typed_config: {'@type': type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bootstrap := rendered(t, testConfig(&bookv1.EnvoySpec{HTTPPolicies: tt.policies}))
+			if names := httpFilterNames(t, bootstrap); !slices.Equal(names, tt.wantFilters) {
+				t.Errorf("HTTP filters = %v, want %v", names, tt.wantFilters)
+			}
+			hcm := connectionManager(t, bootstrap)
+			assertFields(t, object(t, hcm, "route_config", "virtual_hosts", 0), tt.wantVirtualHost)
+			if tt.wantCompressors != "" {
+				var compressors []interface{}
+				for i, name := range tt.wantFilters {
+					if name == compressorFilter {
+						compressors = append(compressors, dig(t, hcm, "http_filters", i, "typed_config"))
+					}
+				}
+				assertYAML(t, "compressors", compressors, tt.wantCompressors)
+			}
+		})
+	}
+}
+
+// The CORS preflight requests are answered before any check, and the
+// responses are compressed last, once the other filters are done with them.
+func TestRenderHTTPFilterOrder(t *testing.T) {
+	spec := &bookv1.EnvoySpec{
+		HTTPPolicies: &bookv1.HTTPPoliciesSpec{
+			CORS:        &bookv1.CORSPolicy{AllowOrigins: []string{"*"}},
+			Compression: &bookv1.CompressionPolicy{Algorithms: []bookv1.CompressionAlgorithm{bookv1.CompressionGzip}},
+		},
+		GRPCWeb:   true,
+		RateLimit: &bookv1.RateLimitSpec{TokenBucket: ptr.To(bucket(10, time.Second))},
+		Auth: &bookv1.AuthSpec{JWT: &bookv1.JWTSpec{Providers: []bookv1.JWTProvider{{
+			Name:   "idp",
+			Issuer: "https://idp.example.com",
+			JWKS:   bookv1.JWKSSource{Inline: `{"keys":[]}`},
+		}}}},
+	}
+	want := []string{corsFilter, grpcWebFilter, localRateLimitFilter, jwtAuthnFilter, compressorFilter, "envoy.filters.http.router"}
+	if names := httpFilterNames(t, rendered(t, testConfig(spec))); !slices.Equal(names, want) {
+		t.Errorf("HTTP filters = %v, want %v", names, want)
+	}
+}
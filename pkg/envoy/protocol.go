@@ -0,0 +1,64 @@
+package envoy
+
+import (
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	httpProtocolOptionsName = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+	httpProtocolOptionsType = "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+	grpcWebFilter           = "envoy.filters.http.grpc_web"
+	grpcWebType             = "type.googleapis.com/envoy.extensions.filters.http.grpc_web.v3.GrpcWeb"
+)
+
+type httpProtocolOptions struct {
+	Type               string             `json:"@type"`
+	ExplicitHTTPConfig explicitHTTPConfig `json:"explicit_http_config"`
+}
+
+type explicitHTTPConfig struct {
+	HTTPProtocolOptions  *struct{} `json:"http_protocol_options,omitempty"`
+	HTTP2ProtocolOptions *struct{} `json:"http2_protocol_options,omitempty"`
+}
+
+type upgradeConfig struct {
+	UpgradeType string `json:"upgrade_type"`
+}
+
+// protocolOptions returns the typed_extension_protocol_options of the
+// book-server cluster, speaking protocol.
+func protocolOptions(protocol bookv1.AppProtocol) map[string]interface{} {
+	config := explicitHTTPConfig{HTTPProtocolOptions: &struct{}{}}
+	if isHTTP2(protocol) {
+		config = explicitHTTPConfig{HTTP2ProtocolOptions: &struct{}{}}
+	}
+	return map[string]interface{}{
+		httpProtocolOptionsName: httpProtocolOptions{Type: httpProtocolOptionsType, ExplicitHTTPConfig: config},
+	}
+}
+
+// codecClientType returns the codec the health checks of hosts speaking
+// protocol use, leaving HTTP/1.1 to the envoy default.
+func codecClientType(protocol bookv1.AppProtocol) string {
+	if isHTTP2(protocol) {
+		return "HTTP2"
+	}
+	return ""
+}
+
+// upgradeConfigs returns the upgrades the listener accepts for protocol.
+func upgradeConfigs(protocol bookv1.AppProtocol) []upgradeConfig {
+	if protocol == bookv1.ProtocolWebSocket {
+		return []upgradeConfig{{UpgradeType: "websocket"}}
+	}
+	return nil
+}
+
+func grpcWebFilterOf() filter {
+	return filter{Name: grpcWebFilter, TypedConfig: typed{Type: grpcWebType}}
+}
+
+// isHTTP2 reports whether protocol runs over HTTP/2.
+func isHTTP2(protocol bookv1.AppProtocol) bool {
+	return protocol == bookv1.ProtocolHTTP2 || protocol == bookv1.ProtocolGRPC
+}
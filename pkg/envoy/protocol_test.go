@@ -0,0 +1,74 @@
+package envoy
+
+import (
+	"slices"
+	"testing"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	http1Options = `
+typed_extension_protocol_options:
+  envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+    '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+    explicit_http_config: {http_protocol_options: {}}
+`
+	http2Options = `
+typed_extension_protocol_options:
+  envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+    '@type': type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+    explicit_http_config: {http2_protocol_options: {}}
+`
+)
+
+func TestRenderUpstreamProtocol(t *testing.T) {
+	tests := []struct {
+		protocol bookv1.AppProtocol
+		// wantCluster are fields of the book-server cluster, in YAML.
+		wantCluster string
+		// wantUpgrades are the upgrade_configs of the listener, in YAML.
+		wantUpgrades string
+		// wantALPN are the protocols negotiated with mutual TLS.
+		wantALPN []string
+	}{
+		{protocol: "", wantCluster: http1Options, wantUpgrades: "null"},
+		{protocol: bookv1.ProtocolHTTP, wantCluster: http1Options, wantUpgrades: "null"},
+		{protocol: bookv1.ProtocolHTTP2, wantCluster: http2Options, wantUpgrades: "null", wantALPN: []string{"h2"}},
+		{protocol: bookv1.ProtocolGRPC, wantCluster: http2Options, wantUpgrades: "null", wantALPN: []string{"h2"}},
+		{protocol: bookv1.ProtocolWebSocket, wantCluster: http1Options, wantUpgrades: "[{upgrade_type: websocket}]"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.protocol), func(t *testing.T) {
+			config := testConfig(nil)
+			config.UpstreamProtocol = tt.protocol
+			bootstrap := rendered(t, config)
+			assertFields(t, clusterNamed(t, bootstrap, UpstreamCluster), tt.wantCluster)
+			assertYAML(t, "upgrade_configs", connectionManager(t, bootstrap)["upgrade_configs"], tt.wantUpgrades)
+
+			config.UpstreamTLS = true
+			cluster := clusterNamed(t, rendered(t, config), UpstreamCluster)
+			var alpn []string
+			if protocols, ok := object(t, cluster, "transport_socket", "typed_config", "common_tls_context")["alpn_protocols"].([]interface{}); ok {
+				for _, protocol := range protocols {
+					alpn = append(alpn, protocol.(string))
+				}
+			}
+			if !slices.Equal(alpn, tt.wantALPN) {
+				t.Errorf("alpn_protocols = %v, want %v", alpn, tt.wantALPN)
+			}
+		})
+	}
+}
+
+func TestRenderGRPCWeb(t *testing.T) {
+	config := testConfig(&bookv1.EnvoySpec{GRPCWeb: true})
+	config.UpstreamProtocol = bookv1.ProtocolGRPC
+	hcm := connectionManager(t, rendered(t, config))
+	assertYAML(t, "http_filters", hcm["http_filters"], `
+- name: envoy.filters.http.grpc_web
+  typed_config: {'@type': type.googleapis.com/envoy.extensions.filters.http.grpc_web.v3.GrpcWeb}
+- name: envoy.filters.http.router
+  typed_config: {'@type': type.googleapis.com/envoy.extensions.filters.http.router.v3.Router}
+`)
+}
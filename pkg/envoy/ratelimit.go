@@ -0,0 +1,124 @@
+package envoy
+
+import (
+	"math"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+)
+
+const (
+	localRateLimitFilter = "envoy.filters.http.local_ratelimit"
+	// rateLimitStatPrefix is shared by the limits of every route, so that
+	// their counters add up.
+	rateLimitStatPrefix  = "book_rate_limit"
+	defaultRateLimitCode = 429
+)
+
+// rateLimitFilter returns the local rate limit HTTP filter. It limits
+// nothing on its own; the limits are set on the routes.
+func rateLimitFilter() filter {
+	return filter{
+		Name:        localRateLimitFilter,
+		TypedConfig: localRateLimit{Type: localRateLimitType, StatPrefix: rateLimitStatPrefix},
+	}
+}
+
+// rateLimitRoutes returns a route per path prefix of spec, then the
+// catch-all route, each carrying its limits.
+func rateLimitRoutes(spec *bookv1.RateLimitSpec, catchAll route) []route {
+	var actions []rateLimit
+	for _, header := range spec.Headers {
+		actions = append(actions, rateLimit{Actions: []rateLimitAction{{
+			RequestHeaders: requestHeadersAction{
+				HeaderName:    header.Name,
+				DescriptorKey: header.Name,
+				SkipIfAbsent:  true,
+			},
+		}}})
+	}
+
+	var routes []route
+	for _, limit := range spec.Routes {
+		r := route{
+			Match: routeMatch{Prefix: limit.PathPrefix},
+			Route: catchAll.Route,
+		}
+		routes = append(routes, withRateLimit(r, spec, &limit.TokenBucket, actions))
+	}
+	return append(routes, withRateLimit(catchAll, spec, spec.TokenBucket, actions))
+}
+
+// withRateLimit sets on r the limits of bucket and of the headers of spec.
+// Without a bucket nor header limit, r is returned as is.
+func withRateLimit(r route, spec *bookv1.RateLimitSpec, bucket *bookv1.TokenBucket, actions []rateLimit) route {
+	if bucket == nil && len(spec.Headers) == 0 {
+		return r
+	}
+
+	config := localRateLimit{
+		Type:       localRateLimitType,
+		StatPrefix: rateLimitStatPrefix,
+		Status:     &httpStatus{Code: int32Or(spec.StatusCode, defaultRateLimitCode)},
+		FilterEnabled: &runtimeFractionalPercent{
+			DefaultValue: fractionalPercent{Numerator: 100, Denominator: "HUNDRED"},
+			RuntimeKey:   "local_rate_limit_enabled",
+		},
+		FilterEnforced: &runtimeFractionalPercent{
+			DefaultValue: fractionalPercent{Numerator: 100, Denominator: "HUNDRED"},
+			RuntimeKey:   "local_rate_limit_enforced",
+		},
+	}
+	if bucket != nil {
+		config.TokenBucket = tokenBucketOf(*bucket)
+	} else {
+		// Envoy needs a bucket for the route even when only the headers are
+		// limited. This one never runs out, and fills at an interval the
+		// header buckets are a multiple of.
+		config.TokenBucket = &tokenBucket{
+			MaxTokens:     math.MaxInt32,
+			TokensPerFill: math.MaxInt32,
+			FillInterval:  duration(commonInterval(spec.Headers)),
+		}
+	}
+	for _, header := range spec.ResponseHeaders {
+		config.ResponseHeadersToAdd = append(config.ResponseHeadersToAdd, headerValueOption{
+			Header:       headerValue{Key: header.Name, Value: header.Value},
+			AppendAction: "OVERWRITE_IF_EXISTS_OR_ADD",
+		})
+	}
+	for _, header := range spec.Headers {
+		config.Descriptors = append(config.Descriptors, localRateLimitDescriptor{
+			Entries:     []descriptorEntry{{Key: header.Name, Value: header.Value}},
+			TokenBucket: *tokenBucketOf(header.TokenBucket),
+		})
+	}
+
+	r.Route.RateLimits = actions
+	if r.TypedPerFilterConfig == nil {
+		r.TypedPerFilterConfig = map[string]interface{}{}
+	}
+	r.TypedPerFilterConfig[localRateLimitFilter] = config
+	return r
+}
+
+func tokenBucketOf(bucket bookv1.TokenBucket) *tokenBucket {
+	return &tokenBucket{
+		MaxTokens:     bucket.MaxTokens,
+		TokensPerFill: int32Or(bucket.TokensPerFill, 1),
+		FillInterval:  duration(bucket.FillInterval.Duration),
+	}
+}
+
+// commonInterval returns the largest interval every fill interval of the
+// header limits is a multiple of, in whole milliseconds.
+func commonInterval(headers []bookv1.HeaderRateLimit) time.Duration {
+	var gcd int64
+	for _, header := range headers {
+		ms := header.TokenBucket.FillInterval.Milliseconds()
+		for ms != 0 {
+			gcd, ms = ms, gcd%ms
+		}
+	}
+	return max(time.Duration(gcd)*time.Millisecond, time.Millisecond)
+}
@@ -0,0 +1,179 @@
+package envoy
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// routes returns the routes of the virtual host of bootstrap.
+func routes(t *testing.T, bootstrap map[string]interface{}) []interface{} {
+	t.Helper()
+	routes, _ := dig(t, connectionManager(t, bootstrap), "route_config", "virtual_hosts", 0, "routes").([]interface{})
+	return routes
+}
+
+func bucket(maxTokens int32, fillInterval time.Duration) bookv1.TokenBucket {
+	return bookv1.TokenBucket{MaxTokens: maxTokens, FillInterval: metav1.Duration{Duration: fillInterval}}
+}
+
+func TestRenderRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *bookv1.RateLimitSpec
+		// want are the routes, in YAML.
+		want string
+	}{
+		{
+			name: "token bucket",
+			spec: &bookv1.RateLimitSpec{TokenBucket: ptr.To(bucket(10, time.Second))},
+			want: `
+- match: {prefix: /}
+  route: {cluster: book-server}
+  typed_per_filter_config:
+    envoy.filters.http.local_ratelimit:
+      '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+      stat_prefix: book_rate_limit
+      status: {code: 429}
+      token_bucket: {max_tokens: 10, tokens_per_fill: 1, fill_interval: 1s}
+      filter_enabled:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enabled
+      filter_enforced:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enforced
+`,
+		},
+		{
+			name: "routes without a catch-all limit",
+			spec: &bookv1.RateLimitSpec{
+				Routes: []bookv1.RouteRateLimit{
+					{PathPrefix: "/books/search", TokenBucket: bucket(5, time.Second)},
+					{PathPrefix: "/books", TokenBucket: bucket(50, 100*time.Millisecond)},
+				},
+				StatusCode:      ptr.To[int32](503),
+				ResponseHeaders: []bookv1.HTTPHeader{{Name: "Retry-After", Value: "1"}},
+			},
+			want: `
+- match: {prefix: /books/search}
+  route: {cluster: book-server}
+  typed_per_filter_config:
+    envoy.filters.http.local_ratelimit:
+      '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+      stat_prefix: book_rate_limit
+      status: {code: 503}
+      token_bucket: {max_tokens: 5, tokens_per_fill: 1, fill_interval: 1s}
+      filter_enabled:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enabled
+      filter_enforced:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enforced
+      response_headers_to_add:
+      - header: {key: Retry-After, value: "1"}
+        append_action: OVERWRITE_IF_EXISTS_OR_ADD
+- match: {prefix: /books}
+  route: {cluster: book-server}
+  typed_per_filter_config:
+    envoy.filters.http.local_ratelimit:
+      '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+      stat_prefix: book_rate_limit
+      status: {code: 503}
+      token_bucket: {max_tokens: 50, tokens_per_fill: 1, fill_interval: 0.1s}
+      filter_enabled:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enabled
+      filter_enforced:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enforced
+      response_headers_to_add:
+      - header: {key: Retry-After, value: "1"}
+        append_action: OVERWRITE_IF_EXISTS_OR_ADD
+- match: {prefix: /}
+  route: {cluster: book-server}
+`,
+		},
+		{
+			name: "headers only",
+			spec: &bookv1.RateLimitSpec{
+				Headers: []bookv1.HeaderRateLimit{
+					{Name: "x-tenant", Value: "free", TokenBucket: bucket(1, 1500*time.Millisecond)},
+					{Name: "x-tenant", Value: "trial", TokenBucket: bucket(2, time.Second)},
+				},
+			},
+			want: `
+- match: {prefix: /}
+  route:
+    cluster: book-server
+    rate_limits:
+    - actions:
+      - request_headers: {header_name: x-tenant, descriptor_key: x-tenant, skip_if_absent: true}
+    - actions:
+      - request_headers: {header_name: x-tenant, descriptor_key: x-tenant, skip_if_absent: true}
+  typed_per_filter_config:
+    envoy.filters.http.local_ratelimit:
+      '@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+      stat_prefix: book_rate_limit
+      status: {code: 429}
+      token_bucket: {max_tokens: 2147483647, tokens_per_fill: 2147483647, fill_interval: 0.5s}
+      filter_enabled:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enabled
+      filter_enforced:
+        default_value: {numerator: 100, denominator: HUNDRED}
+        runtime_key: local_rate_limit_enforced
+      descriptors:
+      - entries: [{key: x-tenant, value: free}]
+        token_bucket: {max_tokens: 1, tokens_per_fill: 1, fill_interval: 1.5s}
+      - entries: [{key: x-tenant, value: trial}]
+        token_bucket: {max_tokens: 2, tokens_per_fill: 1, fill_interval: 1s}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bootstrap := rendered(t, testConfig(&bookv1.EnvoySpec{RateLimit: tt.spec}))
+			assertYAML(t, "routes", routes(t, bootstrap), tt.want)
+
+			// The filter holds no limit of its own, the routes do.
+			names := httpFilterNames(t, bootstrap)
+			if !slices.Equal(names, []string{localRateLimitFilter, "envoy.filters.http.router"}) {
+				t.Errorf("HTTP filters = %v, want the local rate limit then the router", names)
+			}
+			assertFields(t, object(t, connectionManager(t, bootstrap), "http_filters", 0, "typed_config"), `
+'@type': type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit
+stat_prefix: book_rate_limit
+token_bucket: null
+`)
+		})
+	}
+}
+
+func TestCommonInterval(t *testing.T) {
+	headers := func(intervals ...time.Duration) []bookv1.HeaderRateLimit {
+		var headers []bookv1.HeaderRateLimit
+		for _, interval := range intervals {
+			headers = append(headers, bookv1.HeaderRateLimit{TokenBucket: bucket(1, interval)})
+		}
+		return headers
+	}
+	tests := []struct {
+		headers []bookv1.HeaderRateLimit
+		want    time.Duration
+	}{
+		{headers: nil, want: time.Millisecond},
+		{headers: headers(time.Minute), want: time.Minute},
+		{headers: headers(2*time.Second, 3*time.Second), want: time.Second},
+		{headers: headers(1500*time.Millisecond, time.Second), want: 500 * time.Millisecond},
+		{headers: headers(time.Second, 0), want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := commonInterval(tt.headers); got != tt.want {
+			t.Errorf("commonInterval(%d headers) = %s, want %s", len(tt.headers), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package envoy renders the bootstrap configuration of the envoy proxy of a
+// Book.
+package envoy
+
+import (
+	"strconv"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// UpstreamCluster is the name of the envoy cluster of the book-server.
+	UpstreamCluster = "book-server"
+
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = time.Second
+	defaultUnhealthyThreshold  = 3
+	defaultHealthyThreshold    = 1
+	defaultConsecutive5xx      = 5
+	defaultOutlierInterval     = 10 * time.Second
+	defaultBaseEjectionTime    = 30 * time.Second
+	defaultMaxEjectionPercent  = 10
+	upstreamConnectTimeout     = 250 * time.Millisecond
+)
+
+// Config is what the envoy configuration of a Book is rendered from.
+type Config struct {
+	// Name and Namespace of the Book.
+	Name      string
+	Namespace string
+	// ListenPort is the port of the listener.
+	ListenPort int32
+	// AdminPort is the port of the admin API.
+	AdminPort int32
+	// UpstreamHost and UpstreamPort address the pods of the book-server,
+	// through a headless Service, so that the health checks, the outlier
+	// detection and the load balancing see every pod.
+	UpstreamHost string
+	UpstreamPort int32
+	// FallbackHost, when set, is added to the book-server cluster at a lower
+	// priority and only receives requests while no pod is left. It is the
+	// Service address that refuses the connections while the book-server
+	// is scaled to zero, see WakeUpTimeout.
+	FallbackHost string
+	// UpstreamProtocol is the protocol of the book-server port, HTTP/1.1
+	// when empty.
+	UpstreamProtocol bookv1.AppProtocol
+	// UpstreamTLS makes envoy talk mutual TLS to the book-server, with the
+	// certificates mounted in TLSDir.
+	UpstreamTLS bool
+	// Spec is the envoy spec of the Book. It may be nil.
+	Spec *bookv1.EnvoySpec
+	// Mirror is where requests are shadowed to. It may be nil.
+	Mirror *Mirror
+	// WakeUpTimeout, when set, is how long the requests refused by the
+	// book-server are retried, while it scales up from zero.
+	WakeUpTimeout time.Duration
+}
+
+// Render returns the envoy bootstrap configuration, in YAML.
+func Render(config Config) ([]byte, error) {
+	routes := []route{{
+		Match: routeMatch{Prefix: "/"},
+		Route: routeAction{Cluster: UpstreamCluster},
+	}}
+	clusters := []cluster{upstreamCluster(config)}
+	if config.WakeUpTimeout > 0 {
+		routes[0] = withWakeUp(routes[0], config.WakeUpTimeout)
+		clusters[0] = withWakeUpRetries(clusters[0])
+	}
+	if config.Mirror != nil {
+		// Set before the rate limits, so that every route mirrors.
+		routes[0] = withMirror(routes[0], config.Mirror)
+		clusters = append(clusters, mirrorCluster(config.Mirror))
+	}
+	vhost := virtualHost{
+		Name:    "backend",
+		Domains: []string{"*"},
+	}
+	var httpFilters, compression []filter
+	if config.Spec != nil && config.Spec.HTTPPolicies != nil {
+		var cors []filter
+		cors, compression = policyFilters(config.Spec.HTTPPolicies)
+		httpFilters = append(httpFilters, cors...)
+		vhost = withPolicies(vhost, config.Spec.HTTPPolicies)
+	}
+	if config.Spec != nil && config.Spec.GRPCWeb {
+		httpFilters = append(httpFilters, grpcWebFilterOf())
+	}
+	if config.Spec != nil && config.Spec.RateLimit != nil {
+		routes = rateLimitRoutes(config.Spec.RateLimit, routes[0])
+		httpFilters = append(httpFilters, rateLimitFilter())
+	}
+	if config.Spec != nil && config.Spec.Auth != nil && config.Spec.Auth.JWT != nil {
+		httpFilters = append(httpFilters, jwtFilter(config.Spec.Auth.JWT))
+	}
+	httpFilters = append(httpFilters, compression...)
+	vhost.Routes = routes
+	// The router comes last.
+	httpFilters = append(httpFilters, filter{
+		Name:        "envoy.filters.http.router",
+		TypedConfig: typed{Type: routerType},
+	})
+
+	hcm := httpConnectionManager{
+		Type:       httpConnectionManagerType,
+		CodecType:  "AUTO",
+		StatPrefix: "ingress_http",
+		RouteConfig: routeConfig{
+			Name:         "local_route",
+			VirtualHosts: []virtualHost{vhost},
+		},
+		HTTPFilters:    httpFilters,
+		UpgradeConfigs: upgradeConfigs(config.UpstreamProtocol),
+	}
+	if config.Spec != nil && config.Spec.AccessLog != nil {
+		hcm.AccessLog = accessLogs(config.Spec.AccessLog, config.Name, config.Namespace)
+	}
+
+	return yaml.Marshal(bootstrap{
+		StaticResources: staticResources{
+			Listeners: []listener{{
+				Name:    "ingress",
+				Address: socketAddressOf("0.0.0.0", config.ListenPort),
+				FilterChains: []filterChain{{
+					Filters: []filter{{
+						Name:        "envoy.filters.network.http_connection_manager",
+						TypedConfig: hcm,
+					}},
+				}},
+			}},
+			Clusters: clusters,
+		},
+		Admin: admin{Address: socketAddressOf("0.0.0.0", config.AdminPort)},
+	})
+}
+
+// upstreamCluster renders the cluster of the book-server.
+func upstreamCluster(config Config) cluster {
+	c := cluster{
+		Name:                          UpstreamCluster,
+		TypedExtensionProtocolOptions: protocolOptions(config.UpstreamProtocol),
+		ConnectTimeout:                duration(upstreamConnectTimeout),
+		Type:                          "STRICT_DNS",
+		LbPolicy:                      "ROUND_ROBIN",
+		LoadAssignment: loadAssignment{
+			ClusterName: UpstreamCluster,
+			Endpoints: []localityLbEndpoints{{
+				LbEndpoints: []lbEndpoint{{
+					Endpoint: endpoint{Address: socketAddressOf(config.UpstreamHost, config.UpstreamPort)},
+				}},
+			}},
+		},
+	}
+	if config.FallbackHost != "" {
+		c.LoadAssignment.Endpoints = append(c.LoadAssignment.Endpoints, localityLbEndpoints{
+			LbEndpoints: []lbEndpoint{{
+				Endpoint: endpoint{Address: socketAddressOf(config.FallbackHost, config.UpstreamPort)},
+			}},
+			Priority: 1,
+		})
+	}
+	if config.UpstreamTLS {
+		c.TransportSocket = upstreamTLS(config.UpstreamHost, isHTTP2(config.UpstreamProtocol))
+	}
+	if config.Spec == nil || config.Spec.Upstream == nil {
+		return c
+	}
+	upstream := config.Spec.Upstream
+
+	switch upstream.LoadBalancingPolicy {
+	case bookv1.LoadBalancingLeastRequest:
+		c.LbPolicy = "LEAST_REQUEST"
+	case bookv1.LoadBalancingRandom:
+		c.LbPolicy = "RANDOM"
+	}
+
+	if check := upstream.HealthCheck; check != nil {
+		c.HealthChecks = []healthCheck{{
+			Timeout:            durationOr(check.Timeout, defaultHealthCheckTimeout),
+			Interval:           durationOr(check.Interval, defaultHealthCheckInterval),
+			UnhealthyThreshold: int32Or(check.UnhealthyThreshold, defaultUnhealthyThreshold),
+			HealthyThreshold:   int32Or(check.HealthyThreshold, defaultHealthyThreshold),
+			HTTPHealthCheck:    httpHealthCheck{Path: check.Path, CodecClientType: codecClientType(config.UpstreamProtocol)},
+		}}
+	}
+
+	if outlier := upstream.OutlierDetection; outlier != nil {
+		c.OutlierDetection = &outlierDetection{
+			Consecutive5xx:     int32Or(outlier.Consecutive5xx, defaultConsecutive5xx),
+			Interval:           durationOr(outlier.Interval, defaultOutlierInterval),
+			BaseEjectionTime:   durationOr(outlier.BaseEjectionTime, defaultBaseEjectionTime),
+			MaxEjectionPercent: int32Or(outlier.MaxEjectionPercent, defaultMaxEjectionPercent),
+		}
+	}
+
+	if breaker := upstream.CircuitBreaker; breaker != nil {
+		c.CircuitBreakers = &circuitBreakers{Thresholds: []thresholds{{
+			MaxConnections:     breaker.MaxConnections,
+			MaxPendingRequests: breaker.MaxPendingRequests,
+			MaxRequests:        breaker.MaxRequests,
+			MaxRetries:         breaker.MaxRetries,
+		}}}
+	}
+	return c
+}
+
+// HealthCheckInterval returns the interval of the health check of spec, or
+// zero when it has none.
+func HealthCheckInterval(spec *bookv1.HealthCheckSpec) time.Duration {
+	if spec == nil {
+		return 0
+	}
+	if spec.Interval != nil {
+		return spec.Interval.Duration
+	}
+	return defaultHealthCheckInterval
+}
+
+func socketAddressOf(host string, port int32) address {
+	return address{SocketAddress: socketAddress{Address: host, PortValue: port}}
+}
+
+// duration formats d the way the protobuf JSON mapping expects, like "1.5s".
+func duration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+func durationOr(d *metav1.Duration, fallback time.Duration) string {
+	if d == nil {
+		return duration(fallback)
+	}
+	return duration(d.Duration)
+}
+
+func int32Or(i *int32, fallback int32) int32 {
+	if i == nil {
+		return fallback
+	}
+	return *i
+}
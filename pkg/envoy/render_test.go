@@ -0,0 +1,276 @@
+package envoy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	bookv1 "github.com/shiponcs/simple-custom-controller/pkg/apis/simplecustomcontroller/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// testConfig returns the configuration of a Book without any envoy spec.
+func testConfig(spec *bookv1.EnvoySpec) Config {
+	return Config{
+		Name:         "book-api",
+		Namespace:    "default",
+		ListenPort:   8080,
+		AdminPort:    8001,
+		UpstreamHost: "book-api-headless.default.svc",
+		UpstreamPort: 8080,
+		Spec:         spec,
+	}
+}
+
+// rendered returns the configuration rendered from config, decoded.
+func rendered(t *testing.T, config Config) map[string]interface{} {
+	t.Helper()
+	data, err := Render(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bootstrap map[string]interface{}
+	if err := yaml.Unmarshal(data, &bootstrap); err != nil {
+		t.Fatal(err)
+	}
+	return bootstrap
+}
+
+// dig returns the value at path in v, made of map keys and slice indexes.
+func dig(t *testing.T, v interface{}, path ...interface{}) interface{} {
+	t.Helper()
+	for i, step := range path {
+		switch step := step.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("%v: not an object", path[:i+1])
+			}
+			v = m[step]
+		case int:
+			s, ok := v.([]interface{})
+			if !ok || step >= len(s) {
+				t.Fatalf("%v: no such element", path[:i+1])
+			}
+			v = s[step]
+		}
+	}
+	return v
+}
+
+// object returns the object at path in v.
+func object(t *testing.T, v interface{}, path ...interface{}) map[string]interface{} {
+	t.Helper()
+	m, ok := dig(t, v, path...).(map[string]interface{})
+	if !ok {
+		t.Fatalf("%v: not an object", path)
+	}
+	return m
+}
+
+// clusterNamed returns the cluster name of bootstrap.
+func clusterNamed(t *testing.T, bootstrap map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	clusters, _ := dig(t, bootstrap, "static_resources", "clusters").([]interface{})
+	for i := range clusters {
+		if c := object(t, clusters, i); c["name"] == name {
+			return c
+		}
+	}
+	t.Fatalf("no cluster %s rendered", name)
+	return nil
+}
+
+// connectionManager returns the HTTP connection manager of the listener.
+func connectionManager(t *testing.T, bootstrap map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	return object(t, bootstrap, "static_resources", "listeners", 0, "filter_chains", 0, "filters", 0, "typed_config")
+}
+
+// httpFilterNames returns the names of the HTTP filters, in order.
+func httpFilterNames(t *testing.T, bootstrap map[string]interface{}) []string {
+	t.Helper()
+	filters, _ := connectionManager(t, bootstrap)["http_filters"].([]interface{})
+	var names []string
+	for i := range filters {
+		names = append(names, fmt.Sprint(dig(t, filters, i, "name")))
+	}
+	return names
+}
+
+// assertFields checks that the fields of want, in YAML, have the same value
+// in got. A null field must be absent from got.
+func assertFields(t *testing.T, got map[string]interface{}, want string) {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal([]byte(want), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range fields {
+		assertValue(t, key, got[key], value)
+	}
+}
+
+// assertYAML checks that got, named what, is the value of want in YAML.
+func assertYAML(t *testing.T, what string, got interface{}, want string) {
+	t.Helper()
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(want), &value); err != nil {
+		t.Fatal(err)
+	}
+	assertValue(t, what, got, value)
+}
+
+func assertValue(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if !equality.Semantic.DeepEqual(got, want) {
+		gotYAML, _ := yaml.Marshal(got)
+		wantYAML, _ := yaml.Marshal(want)
+		t.Errorf("%s =\n%s\nwant\n%s", what, gotYAML, wantYAML)
+	}
+}
+
+func TestRenderUpstreamCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream *bookv1.UpstreamSpec
+		protocol bookv1.AppProtocol
+		want     string
+	}{
+		{
+			name: "no upstream spec",
+			want: `
+lb_policy: ROUND_ROBIN
+health_checks: null
+outlier_detection: null
+circuit_breakers: null
+load_assignment:
+  cluster_name: book-server
+  endpoints:
+  - lb_endpoints:
+    - endpoint:
+        address:
+          socket_address: {address: book-api-headless.default.svc, port_value: 8080}
+`,
+		},
+		{
+			name:     "health check defaults",
+			upstream: &bookv1.UpstreamSpec{HealthCheck: &bookv1.HealthCheckSpec{Path: "/healthz"}},
+			want: `
+health_checks:
+- timeout: 1s
+  interval: 10s
+  unhealthy_threshold: 3
+  healthy_threshold: 1
+  http_health_check: {path: /healthz}
+`,
+		},
+		{
+			name: "health check",
+			upstream: &bookv1.UpstreamSpec{HealthCheck: &bookv1.HealthCheckSpec{
+				Path:               "/ready",
+				Interval:           &metav1.Duration{Duration: 2500 * time.Millisecond},
+				Timeout:            &metav1.Duration{Duration: 500 * time.Millisecond},
+				UnhealthyThreshold: ptr.To[int32](2),
+				HealthyThreshold:   ptr.To[int32](4),
+			}},
+			want: `
+health_checks:
+- timeout: 0.5s
+  interval: 2.5s
+  unhealthy_threshold: 2
+  healthy_threshold: 4
+  http_health_check: {path: /ready}
+`,
+		},
+		{
+			name:     "health check over HTTP/2",
+			upstream: &bookv1.UpstreamSpec{HealthCheck: &bookv1.HealthCheckSpec{Path: "/healthz"}},
+			protocol: bookv1.ProtocolGRPC,
+			want: `
+health_checks:
+- timeout: 1s
+  interval: 10s
+  unhealthy_threshold: 3
+  healthy_threshold: 1
+  http_health_check: {path: /healthz, codec_client_type: HTTP2}
+`,
+		},
+		{
+			name:     "outlier detection defaults",
+			upstream: &bookv1.UpstreamSpec{OutlierDetection: &bookv1.OutlierDetectionSpec{}},
+			want: `
+outlier_detection:
+  consecutive_5xx: 5
+  interval: 10s
+  base_ejection_time: 30s
+  max_ejection_percent: 10
+`,
+		},
+		{
+			name: "outlier detection",
+			upstream: &bookv1.UpstreamSpec{OutlierDetection: &bookv1.OutlierDetectionSpec{
+				Consecutive5xx:     ptr.To[int32](3),
+				Interval:           &metav1.Duration{Duration: time.Second},
+				BaseEjectionTime:   &metav1.Duration{Duration: time.Minute},
+				MaxEjectionPercent: ptr.To[int32](0),
+			}},
+			want: `
+outlier_detection:
+  consecutive_5xx: 3
+  interval: 1s
+  base_ejection_time: 60s
+  max_ejection_percent: 0
+`,
+		},
+		{
+			name:     "least request",
+			upstream: &bookv1.UpstreamSpec{LoadBalancingPolicy: bookv1.LoadBalancingLeastRequest},
+			want:     `lb_policy: LEAST_REQUEST`,
+		},
+		{
+			name:     "random",
+			upstream: &bookv1.UpstreamSpec{LoadBalancingPolicy: bookv1.LoadBalancingRandom},
+			want:     `lb_policy: RANDOM`,
+		},
+		{
+			name: "circuit breaker",
+			upstream: &bookv1.UpstreamSpec{CircuitBreaker: &bookv1.CircuitBreakerSpec{
+				MaxConnections: ptr.To[int32](100),
+				MaxRetries:     ptr.To[int32](0),
+			}},
+			want: `
+circuit_breakers:
+  thresholds:
+  - {max_connections: 100, max_retries: 0}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig(&bookv1.EnvoySpec{Upstream: tt.upstream})
+			config.UpstreamProtocol = tt.protocol
+			assertFields(t, clusterNamed(t, rendered(t, config), UpstreamCluster), tt.want)
+		})
+	}
+}
+
+func TestHealthCheckInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *bookv1.HealthCheckSpec
+		want time.Duration
+	}{
+		{name: "no health check", want: 0},
+		{name: "default", spec: &bookv1.HealthCheckSpec{Path: "/healthz"}, want: defaultHealthCheckInterval},
+		{name: "set", spec: &bookv1.HealthCheckSpec{Path: "/healthz", Interval: &metav1.Duration{Duration: time.Second}}, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := HealthCheckInterval(tt.spec); got != tt.want {
+			t.Errorf("%s: HealthCheckInterval() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package envoy
+
+import (
+	"path"
+
+	"github.com/shiponcs/simple-custom-controller/pkg/certs"
+)
+
+const (
+	// TLSDir is where the client certificate of envoy, its key and the CA
+	// certificate are mounted in the envoy container.
+	TLSDir = "/etc/envoy/tls"
+
+	upstreamTLSContextType = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext"
+)
+
+type transportSocket struct {
+	Name        string             `json:"name"`
+	TypedConfig upstreamTLSContext `json:"typed_config"`
+}
+
+type upstreamTLSContext struct {
+	Type             string           `json:"@type"`
+	CommonTLSContext commonTLSContext `json:"common_tls_context"`
+	SNI              string           `json:"sni"`
+}
+
+type commonTLSContext struct {
+	TLSCertificates   []tlsCertificate  `json:"tls_certificates"`
+	ValidationContext validationContext `json:"validation_context"`
+	ALPNProtocols     []string          `json:"alpn_protocols,omitempty"`
+}
+
+type tlsCertificate struct {
+	CertificateChain dataSource `json:"certificate_chain"`
+	PrivateKey       dataSource `json:"private_key"`
+}
+
+type validationContext struct {
+	TrustedCA                 dataSource            `json:"trusted_ca"`
+	MatchTypedSubjectAltNames []subjectAltNameMatch `json:"match_typed_subject_alt_names"`
+}
+
+type subjectAltNameMatch struct {
+	SANType string      `json:"san_type"`
+	Matcher stringMatch `json:"matcher"`
+}
+
+type stringMatch struct {
+	Exact string `json:"exact"`
+}
+
+// upstreamTLS returns the transport socket of a cluster of hosts serving
+// host, authenticated with the certificates mounted in TLSDir. HTTP/2 is
+// negotiated through ALPN when http2 is set.
+func upstreamTLS(host string, http2 bool) *transportSocket {
+	context := commonTLSContext{
+		TLSCertificates: []tlsCertificate{{
+			CertificateChain: dataSource{Filename: path.Join(TLSDir, certs.CertKey)},
+			PrivateKey:       dataSource{Filename: path.Join(TLSDir, certs.KeyKey)},
+		}},
+		ValidationContext: validationContext{
+			TrustedCA: dataSource{Filename: path.Join(TLSDir, certs.CAKey)},
+			MatchTypedSubjectAltNames: []subjectAltNameMatch{{
+				SANType: "DNS",
+				Matcher: stringMatch{Exact: host},
+			}},
+		},
+	}
+	if http2 {
+		context.ALPNProtocols = []string{"h2"}
+	}
+	return &transportSocket{
+		Name: "envoy.transport_sockets.tls",
+		TypedConfig: upstreamTLSContext{
+			Type:             upstreamTLSContextType,
+			CommonTLSContext: context,
+			SNI:              host,
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package envoy
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	wakeUpBaseInterval = 250 * time.Millisecond
+	wakeUpMaxInterval  = time.Second
+	// wakeUpMaxRetries replaces the default of 3 concurrent retries of the
+	// book-server cluster, which would turn most of the requests held
+	// during a wake up into errors.
+	wakeUpMaxRetries = 1024
+	// routeTimeout is the default route timeout of envoy, which the
+	// requests reaching the book-server keep during a wake up.
+	routeTimeout = 15 * time.Second
+)
+
+type retryPolicy struct {
+	RetryOn       string       `json:"retry_on"`
+	NumRetries    int32        `json:"num_retries"`
+	PerTryTimeout string       `json:"per_try_timeout,omitempty"`
+	RetryBackOff  retryBackOff `json:"retry_back_off"`
+}
+
+type retryBackOff struct {
+	BaseInterval string `json:"base_interval"`
+	MaxInterval  string `json:"max_interval"`
+}
+
+// withWakeUp makes r retry the requests the book-server refuses, for up to
+// timeout. It holds them while the book-server scales up from zero. Only
+// the requests that never reached the book-server are retried, so that none
+// is processed twice.
+//
+// The route timeout spans the retries, so it is raised by timeout, while
+// the per-try timeout keeps the usual route timeout for the attempt that
+// reaches the book-server. A timed out attempt is not retried: only a
+// request held by a cold start waits longer than routeTimeout.
+func withWakeUp(r route, timeout time.Duration) route {
+	r.Route.Timeout = duration(timeout + routeTimeout)
+	r.Route.RetryPolicy = &retryPolicy{
+		RetryOn:       "connect-failure,refused-stream",
+		NumRetries:    int32(math.Ceil(timeout.Seconds() / wakeUpMaxInterval.Seconds())),
+		PerTryTimeout: duration(routeTimeout),
+		RetryBackOff: retryBackOff{
+			BaseInterval: duration(wakeUpBaseInterval),
+			MaxInterval:  duration(wakeUpMaxInterval),
+		},
+	}
+	return r
+}
+
+// withWakeUpRetries lifts the retry limit of c unless it is set explicitly.
+func withWakeUpRetries(c cluster) cluster {
+	if c.CircuitBreakers == nil {
+		c.CircuitBreakers = &circuitBreakers{Thresholds: []thresholds{{}}}
+	}
+	if c.CircuitBreakers.Thresholds[0].MaxRetries == nil {
+		maxRetries := int32(wakeUpMaxRetries)
+		c.CircuitBreakers.Thresholds[0].MaxRetries = &maxRetries
+	}
+	return c
+}
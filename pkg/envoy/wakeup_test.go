@@ -0,0 +1,79 @@
+package envoy
+
+import (
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// renderedRoute returns the route of the book-server in the configuration
+// rendered from config.
+func renderedRoute(t *testing.T, config Config) map[string]interface{} {
+	t.Helper()
+	data, err := Render(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bootstrap struct {
+		StaticResources struct {
+			Listeners []struct {
+				FilterChains []struct {
+					Filters []struct {
+						TypedConfig struct {
+							RouteConfig struct {
+								VirtualHosts []struct {
+									Routes []map[string]interface{} `json:"routes"`
+								} `json:"virtual_hosts"`
+							} `json:"route_config"`
+						} `json:"typed_config"`
+					} `json:"filters"`
+				} `json:"filter_chains"`
+			} `json:"listeners"`
+		} `json:"static_resources"`
+	}
+	if err := yaml.Unmarshal(data, &bootstrap); err != nil {
+		t.Fatal(err)
+	}
+	for _, listener := range bootstrap.StaticResources.Listeners {
+		for _, chain := range listener.FilterChains {
+			for _, filter := range chain.Filters {
+				for _, vhost := range filter.TypedConfig.RouteConfig.VirtualHosts {
+					for _, r := range vhost.Routes {
+						return r["route"].(map[string]interface{})
+					}
+				}
+			}
+		}
+	}
+	t.Fatal("no route rendered")
+	return nil
+}
+
+func TestWakeUpTimeout(t *testing.T) {
+	config := Config{
+		Name:         "book-api",
+		Namespace:    "default",
+		ListenPort:   8080,
+		AdminPort:    8001,
+		UpstreamHost: "book-api-headless.default.svc",
+		UpstreamPort: 8080,
+	}
+	if r := renderedRoute(t, config); r["timeout"] != nil || r["retry_policy"] != nil {
+		t.Errorf("route without wake up = %v, want the default timeout and no retries", r)
+	}
+
+	config.FallbackHost = "book-api.default.svc"
+	config.WakeUpTimeout = time.Minute
+	r := renderedRoute(t, config)
+	if r["timeout"] != "75s" {
+		t.Errorf("route timeout = %v, want the wake up timeout on top of the default 15s", r["timeout"])
+	}
+	policy, _ := r["retry_policy"].(map[string]interface{})
+	if policy["per_try_timeout"] != "15s" {
+		t.Errorf("per_try_timeout = %v, want the default route timeout 15s", policy["per_try_timeout"])
+	}
+	if policy["retry_on"] != "connect-failure,refused-stream" {
+		t.Errorf("retry_on = %v, want only the requests that did not reach the book-server retried", policy["retry_on"])
+	}
+}
@@ -0,0 +1,184 @@
+// Package envoyadmin reads the state of the upstream clusters of an envoy
+// proxy from its admin API.
+package envoyadmin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsFilter selects the request counters of the upstream clusters and of
+// the ingress listener, and the counters of the local rate limit filters.
+const statsFilter = `^(cluster\..+\.upstream_rq_(total|5xx|pending_total)|http\.ingress_http\.downstream_rq_total|.+\.http_local_rate_limit\.rate_limited)$`
+
+// downstreamRequestsStat counts the requests received by the listener of
+// the rendered configuration. Those of the admin API, queried by the
+// controller itself, are left out.
+const downstreamRequestsStat = "http.ingress_http.downstream_rq_total"
+
+// healthFlagsField separates the host address from its health flags in the
+// lines of /clusters.
+const healthFlagsField = "::health_flags::"
+
+// Cluster is the state of an upstream cluster as seen by one envoy.
+type Cluster struct {
+	// HealthyHosts is the number of hosts whose health flags are healthy.
+	HealthyHosts int32
+	// TotalHosts is the number of hosts of the cluster.
+	TotalHosts int32
+	// Requests is the upstream_rq_total counter of the cluster.
+	Requests uint64
+	// Errors5xx is the upstream_rq_5xx counter of the cluster.
+	Errors5xx uint64
+	// PendingRequests is the upstream_rq_pending_total counter of the
+	// cluster, the requests that waited for a connection.
+	PendingRequests uint64
+}
+
+// Snapshot is the state of an envoy.
+type Snapshot struct {
+	// Clusters are the upstream clusters, by name.
+	Clusters map[string]*Cluster
+	// RateLimited is the number of requests rejected by the local rate
+	// limit filters.
+	RateLimited uint64
+	// DownstreamRequests is the number of requests received by the ingress
+	// listener.
+	DownstreamRequests uint64
+}
+
+// Client queries the admin API of envoy proxies.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a Client giving up on a request after timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}}
+}
+
+// Scrape reads /clusters and /stats from the admin API served at baseURL,
+// for example http://10.0.0.7:8001.
+func (c *Client) Scrape(ctx context.Context, baseURL string) (*Snapshot, error) {
+	snapshot := &Snapshot{Clusters: map[string]*Cluster{}}
+	if err := c.get(ctx, baseURL+"/clusters", snapshot.parseClusters); err != nil {
+		return nil, err
+	}
+	query := url.Values{"filter": []string{statsFilter}}
+	if err := c.get(ctx, baseURL+"/stats?"+query.Encode(), snapshot.parseStats); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (c *Client) get(ctx context.Context, url string, parse func(io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", req.URL.Path, resp.Status)
+	}
+	if err := parse(resp.Body); err != nil {
+		return fmt.Errorf("GET %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+func (s *Snapshot) cluster(name string) *Cluster {
+	cluster, ok := s.Clusters[name]
+	if !ok {
+		cluster = &Cluster{}
+		s.Clusters[name] = cluster
+	}
+	return cluster
+}
+
+// parseClusters reads the text output of /clusters. Every host of a cluster
+// has a line like
+//
+//	book-server::10.0.0.5:8080::health_flags::healthy
+//
+// and hosts failing a check list the failures instead of healthy. The host
+// address may itself hold "::", as in [fd00::1]:8080, so the line is split
+// on the cluster name and on the health_flags field only.
+func (s *Snapshot) parseClusters(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), "::")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, healthFlagsField)
+		if i <= 0 {
+			continue
+		}
+		cluster := s.cluster(name)
+		cluster.TotalHosts++
+		if rest[i+len(healthFlagsField):] == "healthy" {
+			cluster.HealthyHosts++
+		}
+	}
+	return scanner.Err()
+}
+
+// parseStats reads the text output of /stats, one "name: value" per line.
+// The rate limited counters of all the filters are added up.
+func (s *Snapshot) parseStats(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(name, ".http_local_rate_limit.rate_limited") {
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", name, err)
+			}
+			s.RateLimited += n
+			continue
+		}
+		if name == downstreamRequestsStat {
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing %s: %w", name, err)
+			}
+			s.DownstreamRequests = n
+			continue
+		}
+		if !strings.HasPrefix(name, "cluster.") {
+			continue
+		}
+		name = strings.TrimPrefix(name, "cluster.")
+		var counter *uint64
+		switch {
+		case strings.HasSuffix(name, ".upstream_rq_total"):
+			counter = &s.cluster(strings.TrimSuffix(name, ".upstream_rq_total")).Requests
+		case strings.HasSuffix(name, ".upstream_rq_5xx"):
+			counter = &s.cluster(strings.TrimSuffix(name, ".upstream_rq_5xx")).Errors5xx
+		case strings.HasSuffix(name, ".upstream_rq_pending_total"):
+			counter = &s.cluster(strings.TrimSuffix(name, ".upstream_rq_pending_total")).PendingRequests
+		default:
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+		*counter = n
+	}
+	return scanner.Err()
+}
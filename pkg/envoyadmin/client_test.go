@@ -0,0 +1,92 @@
+package envoyadmin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const clustersOutput = `book-server::observability_name::book-server
+book-server::default_priority::max_connections::1024
+book-server::10.0.0.5:8080::cx_active::2
+book-server::10.0.0.5:8080::health_flags::healthy
+book-server::10.0.0.6:8080::health_flags::/failed_active_hc
+book-server::[fd00::7]:8080::rq_total::3
+book-server::[fd00::7]:8080::health_flags::healthy
+book-server::[fd00::8]:8080::health_flags::/failed_outlier_check/failed_active_hc
+mirror::10.0.1.5:8080::health_flags::healthy
+`
+
+const statsOutput = `cluster.book-server.upstream_rq_5xx: 4
+cluster.book-server.upstream_rq_pending_total: 9
+cluster.book-server.upstream_rq_total: 120
+cluster.mirror.upstream_rq_total: 12
+http.ingress_http.downstream_rq_total: 130
+http.ingress_http.http_local_rate_limit.rate_limited: 5
+http.ingress_grpc.http_local_rate_limit.rate_limited: 2
+`
+
+func TestScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/clusters":
+			_, _ = w.Write([]byte(clustersOutput))
+		case "/stats":
+			if r.URL.Query().Get("filter") != statsFilter {
+				t.Errorf("GET /stats with filter %q, want %q", r.URL.Query().Get("filter"), statsFilter)
+			}
+			_, _ = w.Write([]byte(statsOutput))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	snapshot, err := NewClient(time.Second).Scrape(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Scrape: %v", err)
+	}
+	want := &Snapshot{
+		Clusters: map[string]*Cluster{
+			"book-server": {HealthyHosts: 2, TotalHosts: 4, Requests: 120, Errors5xx: 4, PendingRequests: 9},
+			"mirror":      {HealthyHosts: 1, TotalHosts: 1, Requests: 12},
+		},
+		RateLimited:        7,
+		DownstreamRequests: 130,
+	}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("Scrape returned %s, want %s", format(snapshot), format(want))
+	}
+}
+
+func TestScrapeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stats" {
+			_, _ = w.Write([]byte("cluster.book-server.upstream_rq_total: many\n"))
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(time.Second)
+	if _, err := client.Scrape(context.Background(), server.URL); err == nil {
+		t.Errorf("Scrape succeeded on a failing /clusters")
+	}
+	snapshot := &Snapshot{Clusters: map[string]*Cluster{}}
+	if err := client.get(context.Background(), server.URL+"/stats", snapshot.parseStats); err == nil {
+		t.Errorf("parsing a non numeric counter succeeded")
+	}
+}
+
+func format(s *Snapshot) string {
+	clusters := map[string]Cluster{}
+	for name, cluster := range s.Clusters {
+		clusters[name] = *cluster
+	}
+	return fmt.Sprintf("{Clusters:%+v RateLimited:%d DownstreamRequests:%d}", clusters, s.RateLimited, s.DownstreamRequests)
+}
@@ -0,0 +1,47 @@
+package healthz
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Checker is a single named health check.
+type Checker struct {
+	Name  string
+	Check func(req *http.Request) error
+}
+
+// Ping always succeeds. It tells that the HTTP server is up.
+var Ping = Checker{Name: "ping", Check: func(*http.Request) error { return nil }}
+
+// InstallHandler registers path on mux. The handler answers 200 when every
+// check passes and 500 with the failing checks otherwise. With the verbose
+// query parameter the result of every check is listed.
+func InstallHandler(mux *http.ServeMux, path string, checks ...Checker) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
+		var out strings.Builder
+		failed := false
+		for _, check := range checks {
+			if err := check.Check(req); err != nil {
+				failed = true
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", check.Name, err)
+				continue
+			}
+			fmt.Fprintf(&out, "[+]%s ok\n", check.Name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "%s%s check failed\n", out.String(), strings.TrimPrefix(path, "/"))
+			return
+		}
+		if _, verbose := req.URL.Query()["verbose"]; verbose {
+			fmt.Fprintf(w, "%s%s check passed\n", out.String(), strings.TrimPrefix(path, "/"))
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+}
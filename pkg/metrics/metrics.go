@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Registry holds every metric exposed by the controller.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ReconcileDuration observes how long a syncHandler call took, labeled
+	// by its result.
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "book_reconcile_duration_seconds",
+		Help:    "Time taken to reconcile a Book, by result.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"result"})
+
+	// ReconcileTotal counts syncHandler calls, labeled by their result.
+	ReconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "book_reconcile_total",
+		Help: "Number of Book reconciles, by result.",
+	}, []string{"result"})
+
+	// ChildOperations counts the writes the controller issued for the
+	// objects owned by a Book.
+	ChildOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "book_child_operations_total",
+		Help: "Number of create, update and delete calls for Book owned objects, by kind.",
+	}, []string{"kind", "operation"})
+
+	// ReconcilePanics counts the panics recovered while syncing a Book.
+	ReconcilePanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "book_reconcile_panics_total",
+		Help: "Number of panics recovered while reconciling a Book.",
+	})
+
+	// BookAvailableReplicas mirrors status.availableReplicas of every Book.
+	BookAvailableReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_available_replicas",
+		Help: "Available replicas of the Deployment backing a Book.",
+	}, []string{"namespace", "name"})
+
+	// EnvoyUpstreamHealthyHosts mirrors the healthy hosts of every upstream
+	// in status.envoy.
+	EnvoyUpstreamHealthyHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_envoy_upstream_healthy_hosts",
+		Help: "Healthy hosts of an upstream cluster of the envoy proxies of a Book.",
+	}, []string{"namespace", "name", "upstream"})
+
+	// EnvoyUpstreamHosts mirrors the hosts of every upstream in
+	// status.envoy.
+	EnvoyUpstreamHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_envoy_upstream_hosts",
+		Help: "Hosts of an upstream cluster of the envoy proxies of a Book.",
+	}, []string{"namespace", "name", "upstream"})
+
+	// EnvoyUpstreamRequestRate is the request rate of every upstream,
+	// summed over the envoy proxies of a Book.
+	EnvoyUpstreamRequestRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_envoy_upstream_requests_per_second",
+		Help: "Requests per second sent to an upstream cluster by the envoy proxies of a Book.",
+	}, []string{"namespace", "name", "upstream"})
+
+	// EnvoyUpstreamErrorRate is the 5xx rate of every upstream, summed over
+	// the envoy proxies of a Book.
+	EnvoyUpstreamErrorRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_envoy_upstream_5xx_per_second",
+		Help: "5xx responses per second returned by an upstream cluster to the envoy proxies of a Book.",
+	}, []string{"namespace", "name", "upstream"})
+
+	// EnvoyRateLimitedRate is the rate of the requests rejected by the
+	// local rate limits, summed over the envoy proxies of a Book.
+	EnvoyRateLimitedRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "book_envoy_rate_limited_per_second",
+		Help: "Requests per second rejected by the local rate limits of the envoy proxies of a Book.",
+	}, []string{"namespace", "name"})
+
+	// EnvoyAdminScrapeErrors counts the failed queries of the envoy admin
+	// API.
+	EnvoyAdminScrapeErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "book_envoy_admin_scrape_errors_total",
+		Help: "Number of failed queries of the admin API of envoy proxies.",
+	})
+)
+
+const (
+	// ResultSuccess labels a reconcile that converged.
+	ResultSuccess = "success"
+	// ResultError labels a reconcile that returned an error.
+	ResultError = "error"
+
+	// OperationCreate labels a create call in ChildOperations.
+	OperationCreate = "create"
+	// OperationUpdate labels an update call in ChildOperations.
+	OperationUpdate = "update"
+	// OperationDelete labels a delete call in ChildOperations.
+	OperationDelete = "delete"
+)
+
+var informerCaches = &cacheCollector{
+	desc: prometheus.NewDesc("book_informer_cache_objects",
+		"Number of objects held in an informer cache, by resource.", []string{"resource"}, nil),
+	stores: map[string][]cache.Store{},
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ReconcileDuration,
+		ReconcileTotal,
+		ChildOperations,
+		ReconcilePanics,
+		BookAvailableReplicas,
+		EnvoyUpstreamHealthyHosts,
+		EnvoyUpstreamHosts,
+		EnvoyUpstreamRequestRate,
+		EnvoyUpstreamErrorRate,
+		EnvoyRateLimitedRate,
+		EnvoyAdminScrapeErrors,
+		informerCaches,
+	)
+	registerWorkqueueMetrics()
+}
+
+// Handler returns the HTTP handler serving the metrics of Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterInformerCache reports the size of the store under the given
+// resource name. The sizes of the stores registered under the same name,
+// one per watched namespace, are added up.
+func RegisterInformerCache(resource string, store cache.Store) {
+	informerCaches.mu.Lock()
+	defer informerCaches.mu.Unlock()
+	informerCaches.stores[resource] = append(informerCaches.stores[resource], store)
+}
+
+// cacheCollector reads the informer store sizes when it is scraped, so that
+// the numbers are never stale.
+type cacheCollector struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	stores map[string][]cache.Store
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for resource, stores := range c.stores {
+		size := 0
+		for _, store := range stores {
+			size += len(store.ListKeys())
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size), resource)
+	}
+}
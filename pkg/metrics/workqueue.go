@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shiponcs/simple-custom-controller/pkg/priorityqueue"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// The workqueue metrics use the same names as the ones exported by the
+// Kubernetes controller-manager so existing dashboards work unchanged.
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workqueue_depth",
+		Help: "Current depth of the workqueue.",
+	}, []string{"name"})
+
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workqueue_adds_total",
+		Help: "Total number of adds handled by the workqueue.",
+	}, []string{"name"})
+
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workqueue_queue_duration_seconds",
+		Help:    "How long in seconds an item stays in the workqueue before being requested.",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 12),
+	}, []string{"name"})
+
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workqueue_work_duration_seconds",
+		Help:    "How long in seconds processing an item from the workqueue takes.",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 12),
+	}, []string{"name"})
+
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workqueue_unfinished_work_seconds",
+		Help: "How many seconds of work has been done that is in progress and hasn't been observed by work_duration.",
+	}, []string{"name"})
+
+	workqueueLongestRunningProcessor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workqueue_longest_running_processor_seconds",
+		Help: "How many seconds has the longest running processor for the workqueue been running.",
+	}, []string{"name"})
+
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workqueue_retries_total",
+		Help: "Total number of retries handled by the workqueue.",
+	}, []string{"name"})
+
+	workqueuePriorityLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workqueue_priority_queue_duration_seconds",
+		Help:    "How long in seconds an item stays in the workqueue before being requested, by priority.",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 12),
+	}, []string{"name", "priority"})
+)
+
+func registerWorkqueueMetrics() {
+	Registry.MustRegister(
+		workqueueDepth,
+		workqueueAdds,
+		workqueueLatency,
+		workqueueWorkDuration,
+		workqueueUnfinishedWork,
+		workqueueLongestRunningProcessor,
+		workqueueRetries,
+		workqueuePriorityLatency,
+	)
+}
+
+// WorkqueueProvider is a workqueue.MetricsProvider that records the queue
+// metrics in Registry. It also records the wait time by priority of the
+// priority queues.
+type WorkqueueProvider struct{}
+
+var (
+	_ workqueue.MetricsProvider         = WorkqueueProvider{}
+	_ priorityqueue.WaitMetricsProvider = WorkqueueProvider{}
+)
+
+func (WorkqueueProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+func (WorkqueueProvider) NewPriorityLatencyMetric(name, priority string) workqueue.HistogramMetric {
+	return workqueuePriorityLatency.WithLabelValues(name, priority)
+}
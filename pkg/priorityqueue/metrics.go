@@ -0,0 +1,66 @@
+package priorityqueue
+
+import (
+	"k8s.io/client-go/util/workqueue"
+)
+
+// queueMetrics are the metrics of the client-go work queues, plus the wait
+// time by priority.
+type queueMetrics struct {
+	depth                   workqueue.GaugeMetric
+	adds                    workqueue.CounterMetric
+	latency                 workqueue.HistogramMetric
+	priorityLatency         [numPriorities]workqueue.HistogramMetric
+	workDuration            workqueue.HistogramMetric
+	unfinishedWork          workqueue.SettableGaugeMetric
+	longestRunningProcessor workqueue.SettableGaugeMetric
+	retries                 workqueue.CounterMetric
+}
+
+func newQueueMetrics(config Config) queueMetrics {
+	var m queueMetrics
+	provider := config.MetricsProvider
+	if provider == nil || config.Name == "" {
+		provider = noopProvider{}
+	}
+	m.depth = provider.NewDepthMetric(config.Name)
+	m.adds = provider.NewAddsMetric(config.Name)
+	m.latency = provider.NewLatencyMetric(config.Name)
+	m.workDuration = provider.NewWorkDurationMetric(config.Name)
+	m.unfinishedWork = provider.NewUnfinishedWorkSecondsMetric(config.Name)
+	m.longestRunningProcessor = provider.NewLongestRunningProcessorSecondsMetric(config.Name)
+	m.retries = provider.NewRetriesMetric(config.Name)
+
+	waitProvider, ok := provider.(WaitMetricsProvider)
+	for priority := Low; priority < numPriorities; priority++ {
+		if ok {
+			m.priorityLatency[priority] = waitProvider.NewPriorityLatencyMetric(config.Name, priority.String())
+		} else {
+			m.priorityLatency[priority] = noopMetric{}
+		}
+	}
+	return m
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Inc()            {}
+func (noopMetric) Dec()            {}
+func (noopMetric) Set(float64)     {}
+func (noopMetric) Observe(float64) {}
+
+type noopProvider struct{}
+
+func (noopProvider) NewDepthMetric(string) workqueue.GaugeMetric       { return noopMetric{} }
+func (noopProvider) NewAddsMetric(string) workqueue.CounterMetric      { return noopMetric{} }
+func (noopProvider) NewLatencyMetric(string) workqueue.HistogramMetric { return noopMetric{} }
+func (noopProvider) NewWorkDurationMetric(string) workqueue.HistogramMetric {
+	return noopMetric{}
+}
+func (noopProvider) NewUnfinishedWorkSecondsMetric(string) workqueue.SettableGaugeMetric {
+	return noopMetric{}
+}
+func (noopProvider) NewLongestRunningProcessorSecondsMetric(string) workqueue.SettableGaugeMetric {
+	return noopMetric{}
+}
+func (noopProvider) NewRetriesMetric(string) workqueue.CounterMetric { return noopMetric{} }
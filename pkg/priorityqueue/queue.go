@@ -0,0 +1,389 @@
+package priorityqueue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// Priority orders the items of a Queue. Items of a higher priority are handed
+// out first; items of the same priority in the order they were added.
+type Priority int
+
+const (
+	// Low is the priority of the periodic resyncs.
+	Low Priority = iota
+	// Normal is the priority of the retries and of the changes to owned
+	// objects.
+	Normal
+	// High is the priority of the changes made by users.
+	High
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case Normal:
+		return "normal"
+	case High:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// WaitMetricsProvider is implemented by the workqueue.MetricsProvider that
+// also record how long the items waited, by priority.
+type WaitMetricsProvider interface {
+	NewPriorityLatencyMetric(name, priority string) workqueue.HistogramMetric
+}
+
+// Config configures a Queue.
+type Config struct {
+	// Name labels the metrics of the queue.
+	Name string
+	// MetricsProvider creates the metrics of the queue. When it implements
+	// WaitMetricsProvider the wait time is also recorded per priority.
+	MetricsProvider workqueue.MetricsProvider
+}
+
+// Queue is a rate limited work queue whose items carry a priority. Like the
+// client-go work queues, an item is never handed out to two workers at once,
+// and an item added several times before being processed is processed once,
+// at the highest of the priorities it was added with.
+type Queue[T comparable] struct {
+	rateLimiter workqueue.TypedRateLimiter[T]
+	cond        *sync.Cond
+
+	// queues holds the items waiting to be processed, one FIFO per
+	// priority. An item moved to a higher priority is left behind in its
+	// former FIFO; such stale entries are skipped by Get.
+	queues [numPriorities][]T
+	// dirty maps the items waiting to be processed to their priority.
+	dirty map[T]Priority
+	// addedAt is when each waiting item was first added.
+	addedAt map[T]time.Time
+	// processing maps the items being processed to the time they were
+	// handed out.
+	processing map[T]time.Time
+	// pending is the number of items waiting in queues.
+	pending int
+	// waiting holds the items added with a delay that has not passed yet,
+	// one deadline per item.
+	waiting map[T]*waitingItem
+
+	shuttingDown bool
+	drain        bool
+	stopCh       chan struct{}
+
+	metrics queueMetrics
+}
+
+// New returns a Queue retrying its items after the delays of rateLimiter.
+func New[T comparable](rateLimiter workqueue.TypedRateLimiter[T], config Config) *Queue[T] {
+	q := &Queue[T]{
+		rateLimiter: rateLimiter,
+		cond:        sync.NewCond(&sync.Mutex{}),
+		dirty:       map[T]Priority{},
+		addedAt:     map[T]time.Time{},
+		processing:  map[T]time.Time{},
+		waiting:     map[T]*waitingItem{},
+		stopCh:      make(chan struct{}),
+		metrics:     newQueueMetrics(config),
+	}
+	go q.updateUnfinishedWorkLoop()
+	return q
+}
+
+// Add marks item as needing processing with the given priority.
+func (q *Queue[T]) Add(item T, priority Priority) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+
+	if current, ok := q.dirty[item]; ok {
+		if priority > current {
+			q.dirty[item] = priority
+			if _, processing := q.processing[item]; !processing {
+				q.queues[priority] = append(q.queues[priority], item)
+			}
+		}
+		return
+	}
+
+	q.metrics.adds.Inc()
+	q.dirty[item] = priority
+	q.addedAt[item] = time.Now()
+	if _, processing := q.processing[item]; processing {
+		// Done queues it again.
+		return
+	}
+	q.push(item, priority)
+}
+
+// waitingItem is an item added with a delay.
+type waitingItem struct {
+	readyAt  time.Time
+	priority Priority
+	timer    *time.Timer
+}
+
+// AddAfter adds item with the given priority once delay has passed. Like the
+// client-go delaying queue, an item waits at most once: when it is already
+// waiting, the earliest of the two deadlines and the highest of the two
+// priorities are kept.
+func (q *Queue[T]) AddAfter(item T, delay time.Duration, priority Priority) {
+	if delay <= 0 {
+		q.Add(item, priority)
+		return
+	}
+
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	readyAt := time.Now().Add(delay)
+	if waiting, ok := q.waiting[item]; ok {
+		if priority > waiting.priority {
+			waiting.priority = priority
+		}
+		if !readyAt.Before(waiting.readyAt) {
+			return
+		}
+		// A timer that already fired finds itself replaced and does
+		// nothing.
+		waiting.timer.Stop()
+		priority = waiting.priority
+	}
+	waiting := &waitingItem{readyAt: readyAt, priority: priority}
+	waiting.timer = time.AfterFunc(delay, func() {
+		q.cond.L.Lock()
+		if q.waiting[item] != waiting {
+			q.cond.L.Unlock()
+			return
+		}
+		delete(q.waiting, item)
+		priority := waiting.priority
+		q.cond.L.Unlock()
+		q.Add(item, priority)
+	})
+	q.waiting[item] = waiting
+}
+
+// AddRateLimited adds item with the Normal priority once the rate limiter
+// says it is ok.
+func (q *Queue[T]) AddRateLimited(item T) {
+	q.metrics.retries.Inc()
+	q.AddAfter(item, q.rateLimiter.When(item), Normal)
+}
+
+// Forget resets the rate limiting of item.
+func (q *Queue[T]) Forget(item T) {
+	q.rateLimiter.Forget(item)
+}
+
+// NumRequeues returns how many times item was retried since it was last
+// forgotten.
+func (q *Queue[T]) NumRequeues(item T) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// Len returns the number of items waiting to be processed.
+func (q *Queue[T]) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.pending
+}
+
+// Processing returns the items handed out by Get and not done yet.
+func (q *Queue[T]) Processing() []T {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	items := make([]T, 0, len(q.processing))
+	for item := range q.processing {
+		items = append(items, item)
+	}
+	return items
+}
+
+// OldestAdded returns when the item waiting the longest was added. ok is
+// false when no item is waiting.
+func (q *Queue[T]) OldestAdded() (oldest time.Time, ok bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for item, added := range q.addedAt {
+		if _, processing := q.processing[item]; processing {
+			continue
+		}
+		if !ok || added.Before(oldest) {
+			oldest, ok = added, true
+		}
+	}
+	return oldest, ok
+}
+
+// Get blocks until an item can be processed and returns the one with the
+// highest priority. Done must be called once the item is processed. When
+// shutdown is true the queue is shutting down and the caller should stop.
+func (q *Queue[T]) Get() (item T, shutdown bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for {
+		for q.pending == 0 && !q.shuttingDown {
+			q.cond.Wait()
+		}
+		if q.pending == 0 {
+			return item, true
+		}
+		if item, ok := q.pop(); ok {
+			return item, false
+		}
+
+		// Every pending item has an entry at its priority, so this is a
+		// bug in the bookkeeping of the queue. Handing out a zero item
+		// would have it synced; the count is reset instead, and the
+		// items it stood for are lost until they are added again.
+		err := fmt.Errorf("%d items pending in the queue but none found in its FIFOs", q.pending)
+		klog.ErrorS(err, "Priority queue is inconsistent, dropping the pending count")
+		utilruntime.HandleError(err)
+		for ; q.pending > 0; q.pending-- {
+			q.metrics.depth.Dec()
+		}
+	}
+}
+
+// pop removes the item with the highest priority from the FIFOs and marks it
+// as processing. ok is false when no entry is left in the FIFOs. It must be
+// called with the lock held.
+func (q *Queue[T]) pop() (item T, ok bool) {
+	for priority := numPriorities - 1; priority >= Low; priority-- {
+		for len(q.queues[priority]) > 0 {
+			item = q.queues[priority][0]
+			var zero T
+			q.queues[priority][0] = zero
+			q.queues[priority] = q.queues[priority][1:]
+
+			if current, ok := q.dirty[item]; !ok || current != priority {
+				continue
+			}
+			if _, processing := q.processing[item]; processing {
+				continue
+			}
+
+			now := time.Now()
+			wait := now.Sub(q.addedAt[item]).Seconds()
+			q.metrics.latency.Observe(wait)
+			q.metrics.priorityLatency[priority].Observe(wait)
+			q.metrics.depth.Dec()
+			delete(q.dirty, item)
+			delete(q.addedAt, item)
+			q.processing[item] = now
+			q.pending--
+			return item, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Done marks item as processed. If it was added again while being processed
+// it is queued again.
+func (q *Queue[T]) Done(item T) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if start, ok := q.processing[item]; ok {
+		q.metrics.workDuration.Observe(time.Since(start).Seconds())
+		delete(q.processing, item)
+	}
+	if priority, ok := q.dirty[item]; ok {
+		q.push(item, priority)
+	} else if len(q.processing) == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// ShutDown makes Get return shutdown once the waiting items are handed out.
+// Items added from now on are ignored.
+func (q *Queue[T]) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shutDown()
+}
+
+// ShutDownWithDrain shuts the queue down like ShutDown, then blocks until
+// the items being processed are done.
+func (q *Queue[T]) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.drain = true
+	q.shutDown()
+	for len(q.processing) != 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+// ShuttingDown reports whether the queue is shutting down.
+func (q *Queue[T]) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+// shutDown must be called with the lock held.
+func (q *Queue[T]) shutDown() {
+	if !q.shuttingDown {
+		q.shuttingDown = true
+		close(q.stopCh)
+		for item, waiting := range q.waiting {
+			waiting.timer.Stop()
+			delete(q.waiting, item)
+		}
+	}
+	q.cond.Broadcast()
+}
+
+// push appends a waiting item to the FIFO of its priority. It must be called
+// with the lock held.
+func (q *Queue[T]) push(item T, priority Priority) {
+	q.queues[priority] = append(q.queues[priority], item)
+	q.pending++
+	q.metrics.depth.Inc()
+	q.cond.Signal()
+}
+
+func (q *Queue[T]) updateUnfinishedWorkLoop() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		q.cond.L.Lock()
+		var total, longest float64
+		now := time.Now()
+		for _, start := range q.processing {
+			elapsed := now.Sub(start).Seconds()
+			total += elapsed
+			if elapsed > longest {
+				longest = elapsed
+			}
+		}
+		q.cond.L.Unlock()
+		q.metrics.unfinishedWork.Set(total)
+		q.metrics.longestRunningProcessor.Set(longest)
+	}
+}
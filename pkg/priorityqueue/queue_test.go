@@ -0,0 +1,271 @@
+package priorityqueue
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestAddAfterKeepsOneDeadline(t *testing.T) {
+	q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+	defer q.ShutDown()
+
+	// A Book synced many times before its renewal is due waits once.
+	for i := 0; i < 100; i++ {
+		q.AddAfter("book", time.Hour, Low)
+	}
+	q.AddAfter("book", 10*time.Millisecond, Low)
+	q.AddAfter("book", time.Hour, High)
+	q.cond.L.Lock()
+	waiting := len(q.waiting)
+	q.cond.L.Unlock()
+	if waiting > 1 {
+		t.Fatalf("%d items waiting, want 1", waiting)
+	}
+
+	item, _ := q.Get()
+	if item != "book" {
+		t.Fatalf("Get() = %q, want book", item)
+	}
+	q.Done(item)
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if len(q.waiting) != 0 || q.pending != 0 {
+		t.Errorf("item left waiting or queued after its earliest deadline: waiting %d, pending %d", len(q.waiting), q.pending)
+	}
+}
+
+// add is an item added to the queue with a priority.
+type add struct {
+	item     string
+	priority Priority
+}
+
+func TestGetOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		adds []add
+		want []string
+	}{
+		{
+			name: "high before normal before low",
+			adds: []add{{"a", Low}, {"b", Normal}, {"c", High}, {"d", Normal}, {"e", Low}},
+			want: []string{"c", "b", "d", "a", "e"},
+		},
+		{
+			name: "added again at a higher priority",
+			adds: []add{{"a", Low}, {"b", Normal}, {"c", Low}, {"a", High}},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "added again at a lower priority",
+			adds: []add{{"a", High}, {"b", High}, {"a", Low}},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "added again at the same priority",
+			adds: []add{{"a", Normal}, {"b", Normal}, {"a", Normal}},
+			want: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+			defer q.ShutDown()
+			for _, a := range tt.adds {
+				q.Add(a.item, a.priority)
+			}
+			if got := q.Len(); got != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.want))
+			}
+			var got []string
+			for q.Len() > 0 {
+				item, _ := q.Get()
+				q.Done(item)
+				got = append(got, item)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Get() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddWhileProcessing(t *testing.T) {
+	tests := []struct {
+		name string
+		// adds are made while a is being processed.
+		adds []add
+		// want is the order of the items handed out after a.
+		want []string
+	}{
+		{
+			name: "not added again",
+			adds: []add{{"b", Normal}},
+			want: []string{"b"},
+		},
+		{
+			name: "added again once",
+			adds: []add{{"a", Low}, {"b", Normal}},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "added again several times",
+			adds: []add{{"a", Low}, {"a", Low}, {"b", Normal}, {"a", High}},
+			want: []string{"b", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+			defer q.ShutDown()
+			q.Add("a", Normal)
+			item, _ := q.Get()
+			for _, a := range tt.adds {
+				q.Add(a.item, a.priority)
+			}
+
+			// An item being processed is not handed out again before
+			// Done, whatever its priority.
+			var got []string
+			for q.Len() > 0 {
+				next, _ := q.Get()
+				q.Done(next)
+				got = append(got, next)
+			}
+			q.Done(item)
+			for q.Len() > 0 {
+				next, _ := q.Get()
+				q.Done(next)
+				got = append(got, next)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("items handed out after a = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShutDownWithDrain(t *testing.T) {
+	q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+	q.Add("a", Normal)
+	q.Add("b", Normal)
+	a, _ := q.Get()
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return q.ShuttingDown(), nil
+	}); err != nil {
+		t.Fatal("queue not shutting down")
+	}
+
+	// The waiting items are still handed out, the new ones are dropped.
+	q.Add("c", High)
+	b, shutdown := q.Get()
+	if b != "b" || shutdown {
+		t.Errorf("Get() = %q, %t, want b, false", b, shutdown)
+	}
+	if _, shutdown := q.Get(); !shutdown {
+		t.Error("Get() after the waiting items: shutdown false, want true")
+	}
+
+	q.Done(b)
+	select {
+	case <-drained:
+		t.Fatal("ShutDownWithDrain returned with an item being processed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.Done(a)
+	select {
+	case <-drained:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("ShutDownWithDrain did not return once the items were done")
+	}
+}
+
+func TestOldestAdded(t *testing.T) {
+	q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+	defer q.ShutDown()
+	if _, ok := q.OldestAdded(); ok {
+		t.Error("OldestAdded() of an empty queue: ok true, want false")
+	}
+
+	before := time.Now()
+	q.Add("a", Low)
+	time.Sleep(time.Millisecond)
+	middle := time.Now()
+	q.Add("b", Low)
+	// Adding an item again keeps the time it was first added.
+	q.Add("a", High)
+
+	oldest, ok := q.OldestAdded()
+	if !ok || oldest.Before(before) || oldest.After(middle) {
+		t.Errorf("OldestAdded() = %s, %t, want a time between %s and %s", oldest, ok, before, middle)
+	}
+
+	// The items being processed are not waiting anymore.
+	a, _ := q.Get()
+	if a != "a" {
+		t.Fatalf("Get() = %q, want a", a)
+	}
+	oldest, ok = q.OldestAdded()
+	if !ok || oldest.Before(middle) {
+		t.Errorf("OldestAdded() with a processing = %s, %t, want b, added after %s", oldest, ok, middle)
+	}
+	if got := q.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+	b, _ := q.Get()
+	if _, ok := q.OldestAdded(); ok {
+		t.Error("OldestAdded() with every item processing: ok true, want false")
+	}
+	q.Done(a)
+	q.Done(b)
+}
+
+func TestGetInconsistentCount(t *testing.T) {
+	var handled []error
+	handlers := utilruntime.ErrorHandlers
+	utilruntime.ErrorHandlers = []utilruntime.ErrorHandler{func(_ context.Context, err error, _ string, _ ...interface{}) {
+		handled = append(handled, err)
+	}}
+	defer func() { utilruntime.ErrorHandlers = handlers }()
+
+	q := New(workqueue.DefaultTypedControllerRateLimiter[string](), Config{})
+	defer q.ShutDown()
+	q.cond.L.Lock()
+	q.pending = 2
+	q.cond.L.Unlock()
+
+	got := make(chan string)
+	go func() {
+		item, _ := q.Get()
+		got <- item
+	}()
+	if err := wait.PollUntilContextTimeout(context.Background(), time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return q.Len() == 0, nil
+	}); err != nil {
+		t.Fatal("pending count not reset")
+	}
+	q.Add("a", Normal)
+	select {
+	case item := <-got:
+		if item != "a" {
+			t.Errorf("Get() = %q, want a", item)
+		}
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("Get() did not return the item added after the reset")
+	}
+	if len(handled) != 1 {
+		t.Errorf("%d errors handled, want 1", len(handled))
+	}
+}
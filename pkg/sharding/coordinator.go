@@ -0,0 +1,221 @@
+package sharding
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// GroupLabel is set on every shard Lease. Replicas of the same controller
+// share a group and only see each other's Leases.
+const GroupLabel = "simplecustomcontroller.crd.com/shard-group"
+
+// Config holds the settings for a Coordinator.
+type Config struct {
+	// Namespace the shard Leases live in.
+	Namespace string
+	// Group is the name shared by all the replicas that split the Books
+	// between them.
+	Group string
+	// Identity uniquely identifies this replica, usually the pod name.
+	Identity string
+	// LeaseDuration is how long a replica is considered alive after its
+	// last renewal.
+	LeaseDuration time.Duration
+	// RenewInterval is how often the own Lease is renewed and the peers are
+	// listed.
+	RenewInterval time.Duration
+}
+
+// Coordinator keeps a Lease per replica up to date and maintains a hash
+// ring of all the replicas that currently hold a live Lease.
+type Coordinator struct {
+	client kubernetes.Interface
+	config Config
+
+	mu   sync.RWMutex
+	ring *Ring
+	// renewedAt is when the Lease of this replica was last renewed. Past
+	// the LeaseDuration the peers consider this replica gone and take its
+	// keys over, so it stops owning any.
+	renewedAt time.Time
+	handlers  []func()
+	// synced is closed after the first successful refresh of the ring.
+	synced chan struct{}
+}
+
+// NewCoordinator returns a Coordinator for the given config. Run has to be
+// called before the Coordinator owns any key.
+func NewCoordinator(client kubernetes.Interface, config Config) *Coordinator {
+	return &Coordinator{
+		client: client,
+		config: config,
+		ring:   NewRing(nil),
+		synced: make(chan struct{}),
+	}
+}
+
+// ID returns the identity of this replica.
+func (c *Coordinator) ID() string {
+	return c.config.Identity
+}
+
+// Owns reports whether the object belongs to this replica's shard. Nothing
+// is owned while the Lease of this replica is expired.
+func (c *Coordinator) Owns(objectRef cache.ObjectName) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.expired(time.Now()) {
+		return false
+	}
+	return c.ring.Owner(objectRef.String()) == c.config.Identity
+}
+
+// HasSynced reports whether the ring was built at least once. Owns returns
+// false for every key until then.
+func (c *Coordinator) HasSynced() bool {
+	select {
+	case <-c.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// expired reports whether the Lease of this replica was not renewed within
+// the LeaseDuration. It must be called with the lock held.
+func (c *Coordinator) expired(now time.Time) bool {
+	return now.Sub(c.renewedAt) > c.config.LeaseDuration
+}
+
+// AddMembershipHandler registers a function that is called every time a
+// replica joins or leaves the group. It must be called before Run.
+func (c *Coordinator) AddMembershipHandler(handler func()) {
+	c.handlers = append(c.handlers, handler)
+}
+
+// Run renews the Lease of this replica and refreshes the membership until
+// ctx is cancelled. The Lease is deleted on the way out so that the other
+// replicas take over its Books without waiting for it to expire; ctx should
+// only be cancelled once this replica stopped syncing its Books.
+func (c *Coordinator) Run(ctx context.Context) {
+	logger := klog.FromContext(ctx).WithValues("shard", c.config.Identity)
+	logger.Info("Starting shard coordinator", "group", c.config.Group)
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.renew(ctx); err != nil {
+			logger.Error(err, "Failed to renew shard lease")
+			return
+		}
+		now := time.Now()
+		c.mu.Lock()
+		lapsed := !c.renewedAt.IsZero() && c.expired(now)
+		c.renewedAt = now
+		c.mu.Unlock()
+		if lapsed {
+			logger.Info("Shard lease renewed after it expired")
+		}
+		if err := c.refresh(ctx, lapsed); err != nil {
+			logger.Error(err, "Failed to list shard leases")
+		}
+	}, c.config.RenewInterval)
+
+	logger.Info("Releasing shard lease")
+	err := c.client.CoordinationV1().Leases(c.config.Namespace).Delete(context.Background(), c.leaseName(), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to release shard lease")
+	}
+}
+
+func (c *Coordinator) leaseName() string {
+	return c.config.Group + "-" + c.config.Identity
+}
+
+// renew creates or updates the Lease owned by this replica.
+func (c *Coordinator) renew(ctx context.Context) error {
+	leases := c.client.CoordinationV1().Leases(c.config.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(c.config.LeaseDuration / time.Second)
+
+	lease, err := leases.Get(ctx, c.leaseName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.leaseName(),
+				Namespace: c.config.Namespace,
+				Labels:    map[string]string{GroupLabel: c.config.Group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &c.config.Identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &c.config.Identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// refresh rebuilds the ring from the live Leases of the group and notifies
+// the handlers when the membership changed, or when force is set because
+// this replica owned nothing for a while.
+func (c *Coordinator) refresh(ctx context.Context, force bool) error {
+	selector := labels.SelectorFromSet(labels.Set{GroupLabel: c.config.Group})
+	list, err := c.client.CoordinationV1().Leases(c.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var members []string
+	for _, lease := range list.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if now.After(expiry) {
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+	}
+	ring := NewRing(members)
+
+	c.mu.Lock()
+	changed := !reflect.DeepEqual(c.ring.Members(), ring.Members())
+	if changed {
+		c.ring = ring
+	}
+	c.mu.Unlock()
+	if !c.HasSynced() {
+		close(c.synced)
+	}
+
+	if changed {
+		klog.FromContext(ctx).Info("Shard membership changed", "shard", c.config.Identity, "members", ring.Members())
+	}
+	if changed || force {
+		for _, handler := range c.handlers {
+			handler()
+		}
+	}
+	return nil
+}
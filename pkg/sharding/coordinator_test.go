@@ -0,0 +1,71 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCoordinatorOwnsUntilLeaseExpires(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewSimpleClientset()
+	var unreachable atomic.Bool
+	client.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if unreachable.Load() {
+			return true, nil, errors.New("API server unreachable")
+		}
+		return false, nil, nil
+	})
+	c := NewCoordinator(client, Config{
+		Namespace:     "system",
+		Group:         "books",
+		Identity:      "replica-0",
+		LeaseDuration: time.Second,
+		RenewInterval: 10 * time.Millisecond,
+	})
+	objectRef := cache.NewObjectName("default", "book-api")
+	if c.Owns(objectRef) {
+		t.Error("Owns() before Run: true, want false")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if err := wait.PollUntilContextTimeout(ctx, time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return c.HasSynced(), nil
+	}); err != nil {
+		t.Fatal("ring not synced")
+	}
+	// The only replica of the group owns every Book.
+	if !c.Owns(objectRef) {
+		t.Fatal("Owns() of the only replica: false, want true")
+	}
+
+	// Once the Lease cannot be renewed anymore the peers take the Books
+	// over after the LeaseDuration, and so the replica lets them go.
+	unreachable.Store(true)
+	renewFailed := time.Now()
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, wait.ForeverTestTimeout, true, func(context.Context) (bool, error) {
+		return !c.Owns(objectRef), nil
+	}); err != nil {
+		t.Fatal("Owns() stayed true after the Lease expired")
+	}
+	if elapsed := time.Since(renewFailed); elapsed < time.Second/2 {
+		t.Errorf("Owns() turned false %s after the last renewal, before the Lease expired", elapsed)
+	}
+}
@@ -0,0 +1,82 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// defaultVirtualNodes is the number of points every member gets on the ring.
+// More points spread the keys more evenly between members at the cost of a
+// slightly bigger ring.
+const defaultVirtualNodes = 128
+
+// Ring is a consistent hash ring. Every member is placed on the ring several
+// times, and a key belongs to the first member found walking clockwise from
+// the hash of the key. When a member leaves, only the keys it owned move to
+// the remaining members.
+type Ring struct {
+	members []string
+	tokens  []uint32
+	owners  map[uint32]string
+}
+
+// NewRing builds a ring for the given members. The order of members does not
+// matter, two rings built from the same set always agree on key ownership.
+func NewRing(members []string) *Ring {
+	r := &Ring{
+		members: append([]string(nil), members...),
+		owners:  make(map[uint32]string, len(members)*defaultVirtualNodes),
+	}
+	sort.Strings(r.members)
+	for _, member := range r.members {
+		for i := 0; i < defaultVirtualNodes; i++ {
+			token := hash(member + "#" + strconv.Itoa(i))
+			// On the (unlikely) collision keep the smallest member name so
+			// that every replica resolves it the same way.
+			if owner, ok := r.owners[token]; ok && owner < member {
+				continue
+			}
+			if _, ok := r.owners[token]; !ok {
+				r.tokens = append(r.tokens, token)
+			}
+			r.owners[token] = member
+		}
+	}
+	sort.Slice(r.tokens, func(i, j int) bool { return r.tokens[i] < r.tokens[j] })
+	return r
+}
+
+// Owner returns the member responsible for key, or an empty string if the
+// ring has no members.
+func (r *Ring) Owner(key string) string {
+	if len(r.tokens) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i] >= h })
+	if i == len(r.tokens) {
+		i = 0
+	}
+	return r.owners[r.tokens[i]]
+}
+
+// Members returns the sorted list of members on the ring.
+func (r *Ring) Members() []string {
+	return append([]string(nil), r.members...)
+}
+
+// hash places s on the ring. FNV alone spreads strings that only differ in
+// their last characters, like the virtual nodes of a member or the names of
+// numbered Books, poorly; the finalizer of MurmurHash3 mixes its bits.
+func hash(s string) uint32 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return uint32(x >> 32)
+}
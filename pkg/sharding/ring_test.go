@@ -0,0 +1,87 @@
+package sharding
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+const testKeys = 10000
+
+func members(n int) []string {
+	var members []string
+	for i := 0; i < n; i++ {
+		members = append(members, fmt.Sprintf("replica-%d", i))
+	}
+	return members
+}
+
+func TestRingOwner(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 10} {
+		t.Run(fmt.Sprintf("%d members", n), func(t *testing.T) {
+			ms := members(n)
+			ring := NewRing(ms)
+			reversed := slices.Clone(ms)
+			slices.Reverse(reversed)
+			other := NewRing(reversed)
+
+			keys := map[string]int{}
+			for i := 0; i < testKeys; i++ {
+				key := fmt.Sprintf("default/book-%d", i)
+				owner := ring.Owner(key)
+				if !slices.Contains(ms, owner) {
+					t.Fatalf("Owner(%q) = %q, not a member", key, owner)
+				}
+				// Every replica builds its own ring; they must agree
+				// for a key to have exactly one owner.
+				if got := other.Owner(key); got != owner {
+					t.Fatalf("Owner(%q) = %q and %q depending on the member order", key, owner, got)
+				}
+				keys[owner]++
+			}
+			want := testKeys / n
+			for _, member := range ms {
+				if keys[member] < want/2 || keys[member] > want*3/2 {
+					t.Errorf("member %s owns %d of %d keys, want about %d", member, keys[member], testKeys, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRingOwnerNoMembers(t *testing.T) {
+	if owner := NewRing(nil).Owner("default/book"); owner != "" {
+		t.Errorf("Owner() of an empty ring = %q, want none", owner)
+	}
+}
+
+func TestRingMemberLeaves(t *testing.T) {
+	for _, n := range []int{2, 3, 5, 10} {
+		t.Run(fmt.Sprintf("%d members", n), func(t *testing.T) {
+			ms := members(n)
+			before := NewRing(ms)
+			gone := ms[n/2]
+			after := NewRing(slices.DeleteFunc(slices.Clone(ms), func(m string) bool { return m == gone }))
+
+			moved := 0
+			for i := 0; i < testKeys; i++ {
+				key := fmt.Sprintf("default/book-%d", i)
+				owner := before.Owner(key)
+				if now := after.Owner(key); now != owner {
+					if owner != gone {
+						t.Fatalf("key %q moved from %s to %s, but %s left", key, owner, now, gone)
+					}
+					moved++
+				} else if owner == gone {
+					t.Fatalf("key %q still owned by %s, which left", key, gone)
+				}
+			}
+			// Only the keys of the member that left move, about 1/n of
+			// them.
+			want := testKeys / n
+			if moved < want/2 || moved > want*3/2 {
+				t.Errorf("%d of %d keys moved, want about %d", moved, testKeys, want)
+			}
+		})
+	}
+}
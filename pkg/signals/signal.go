@@ -42,3 +42,28 @@ func SetupSignalHandler() context.Context {
 
 	return ctx
 }
+
+// SetupReloadHandler registers for SIGHUP and returns a channel that receives
+// a value every time SIGHUP is received, that is every time the configuration
+// should be reloaded. Signals received while a value is pending are merged
+// into it. On platforms without SIGHUP the channel never fires.
+func SetupReloadHandler() <-chan struct{} {
+	reload := make(chan struct{}, 1)
+	if len(reloadSignals) == 0 {
+		return reload
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, reloadSignals...)
+	go func() {
+		for range c {
+			select {
+			case reload <- struct{}{}:
+			default:
+				// A reload is already pending.
+			}
+		}
+	}()
+
+	return reload
+}